@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/spotify"
+)
+
+const spotifyProfileURL = "https://api.spotify.com/v1/me"
+
+// How long a validated token is trusted before asking Spotify again
+const tokenCacheTTL = 5 * time.Minute
+
+// Most tokens cached at once, so many distinct tokens can't grow the cache without limit
+const maxCachedTokens = 10000
+
+// Returned by spotifyUserID when Spotify couldn't be asked about a token, as opposed to
+// rejecting it, so the client can retry with the same token
+var errSpotifyUnavailable = errors.New("spotify is unavailable")
+
+var spotifyOAuthConfig *oauth2.Config
+
+// Spotify user IDs allowed to use admin-only operations, from ADMIN_USER_IDS
+var adminUserIDs []string
+
+// Cache of bearer tokens already validated against Spotify, keyed by token
+var (
+	tokenCache   = map[string]cachedSpotifyUser{}
+	tokenCacheMu sync.Mutex
+)
+
+type cachedSpotifyUser struct {
+	UserID    string
+	ExpiresAt time.Time
+}
+
+// Sets up the OAuth2 config used to exchange Spotify authorization codes
+func spotifyAuthConfig() {
+	spotifyOAuthConfig = &oauth2.Config{
+		ClientID:     os.Getenv("SPOTIFY_CLIENT_ID"),
+		ClientSecret: os.Getenv("SPOTIFY_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("SPOTIFY_REDIRECT_URL"),
+		Scopes:       []string{"user-read-private"},
+		Endpoint:     spotify.Endpoint,
+	}
+	adminUserIDs = envList("ADMIN_USER_IDS")
+}
+
+// Exchanges a Spotify authorization code for access and refresh tokens
+//
+//	@Summary	Exchange a Spotify authorization code for tokens
+//	@Tags		auth
+//	@Accept		json
+//	@Produce	json
+//	@Param		request	body	authCallbackRequest	true	"Authorization code from the Spotify redirect"
+//	@Success	200	{object}	envelope{data=authResponse}
+//	@Failure	400	{object}	errorResponse
+//	@Failure	401	{object}	errorResponse
+//	@Failure	415	{object}	errorResponse
+//	@Router		/v1/auth/callback [post]
+func authCallback(c *gin.Context) {
+	var request authCallbackRequest
+
+	if !bindJSON(c, &request) {
+		return
+	}
+
+	token, err := spotifyOAuthConfig.Exchange(c.Request.Context(), request.Code)
+	if err != nil {
+		respondError(c, http.StatusUnauthorized, "Failed to exchange authorization code: "+err.Error())
+		return
+	}
+
+	respond(c, http.StatusOK, "Authenticated successfully!", gin.H{
+		"access_token":  token.AccessToken,
+		"refresh_token": token.RefreshToken,
+		"token_type":    token.TokenType,
+		"expiry":        token.Expiry})
+}
+
+// Rejects requests without a valid Spotify bearer token and stores the Spotify user ID on the context
+func authRequired(c *gin.Context) {
+	header := c.GetHeader("Authorization")
+	token, found := strings.CutPrefix(header, "Bearer ")
+	if !found || token == "" {
+		abortWithErrorCode(c, http.StatusUnauthorized, codeMissingToken, "Missing bearer token")
+		return
+	}
+
+	userID, err := spotifyUserID(c.Request.Context(), token)
+	if errors.Is(err, errSpotifyUnavailable) {
+		abortWithError(c, http.StatusServiceUnavailable, "Could not validate the token with Spotify, try again later: "+err.Error())
+		return
+	}
+	if err != nil {
+		abortWithErrorCode(c, http.StatusUnauthorized, codeInvalidToken, "Invalid Spotify token: "+err.Error())
+		return
+	}
+
+	c.Set("userID", userID)
+	c.Set("spotifyToken", token)
+	c.Next()
+}
+
+// Returns the Spotify user ID that authRequired stored for this request
+func currentUserID(c *gin.Context) string {
+	return c.GetString("userID")
+}
+
+// Returns the Spotify access token the request was authenticated with, for calling Spotify on the user's behalf
+func spotifyAccessToken(c *gin.Context) string {
+	return c.GetString("spotifyToken")
+}
+
+// Reports whether the authenticated user is listed in ADMIN_USER_IDS
+func isAdmin(c *gin.Context) bool {
+	return slices.Contains(adminUserIDs, currentUserID(c))
+}
+
+// Rejects authenticated users who are not admins. Must run after authRequired.
+func adminRequired(c *gin.Context) {
+	if !isAdmin(c) {
+		abortWithErrorCode(c, http.StatusForbidden, codeAdminRequired, "Admin access required")
+		return
+	}
+	c.Next()
+}
+
+// Looks up the Spotify user a token belongs to, using the cache when possible
+func spotifyUserID(ctx context.Context, token string) (string, error) {
+	tokenCacheMu.Lock()
+	cached, ok := tokenCache[token]
+	tokenCacheMu.Unlock()
+	if ok && time.Now().Before(cached.ExpiresAt) {
+		return cached.UserID, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, spotifyProfileURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errSpotifyUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	// Only a 4xx other than rate limiting says anything about the token itself
+	if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+		return "", fmt.Errorf("%w: spotify returned %s", errSpotifyUnavailable, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New("spotify returned " + resp.Status)
+	}
+
+	var profile struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
+		return "", err
+	}
+	if profile.ID == "" {
+		return "", errors.New("spotify profile has no user ID")
+	}
+
+	tokenCacheMu.Lock()
+	if len(tokenCache) >= maxCachedTokens {
+		// Make room by forgetting any token; it is simply validated again when next used
+		for key := range tokenCache {
+			delete(tokenCache, key)
+			break
+		}
+	}
+	tokenCache[token] = cachedSpotifyUser{UserID: profile.ID, ExpiresAt: time.Now().Add(tokenCacheTTL)}
+	tokenCacheMu.Unlock()
+
+	return profile.ID, nil
+}
+
+// Forgets expired tokens every interval until ctx is cancelled
+func runTokenCacheSweep(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			tokenCacheMu.Lock()
+			for key, entry := range tokenCache {
+				if now.After(entry.ExpiresAt) {
+					delete(tokenCache, key)
+				}
+			}
+			tokenCacheMu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Removes orphaned skipped sections every interval until ctx is cancelled
+func runCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			runCtx, cancel := context.WithTimeout(ctx, queryTimeout)
+			deleted, err := songRepo.DeleteOrphanedSections(runCtx)
+			cancel()
+			if err != nil {
+				slog.Error("cleanup failed", slog.String("error", err.Error()))
+				continue
+			}
+			slog.Info("cleanup finished", slog.Int64("deleted_sections", deleted))
+		}
+	}
+}
+
+// Runs the orphaned section cleanup right away
+//
+//	@Summary	Delete orphaned skipped sections now (admin)
+//	@Tags		admin
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Success	200	{object}	envelope{data=deletedCountResponse}
+//	@Failure	403	{object}	errorResponse
+//	@Router		/v1/admin/cleanup [post]
+func cleanupOrphans(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	deleted, err := songRepo.DeleteOrphanedSections(ctx)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to clean up skipped sections: "+err.Error())
+		return
+	}
+	slog.Info("cleanup finished", slog.Int64("deleted_sections", deleted), slog.String("request_id", requestID(c)))
+
+	respond(c, http.StatusOK, "Cleanup completed successfully!", gin.H{"deleted_count": deleted})
+}
@@ -0,0 +1,122 @@
+// Seed inserts a handful of demo songs with skipped sections for local development.
+// Songs that already exist for the user are left untouched, so it is safe to run again.
+//
+//	cd backend && go run ./cmd/seed -user <spotify user ID>
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/joho/godotenv"
+)
+
+type demoSection struct {
+	StartTime int // Milliseconds
+	EndTime   int // Milliseconds
+	Label     *string
+}
+
+type demoSong struct {
+	SongID   string
+	Title    string
+	Artist   string
+	Duration int // Milliseconds
+	Sections []demoSection
+}
+
+func label(text string) *string {
+	return &text
+}
+
+var demoSongs = []demoSong{
+	{"4uLU6hMCjMI75M1A2tKUQC", "Never Gonna Give You Up", "Rick Astley", 213573, []demoSection{
+		{0, 18000, label("long intro")},
+	}},
+	{"7tFiyTwD0nx5a1eklYtX2J", "Bohemian Rhapsody", "Queen", 354320, []demoSection{
+		{247000, 295000, label("hard rock section")},
+	}},
+	{"5CQ30WqJwcep0pYcV4AMNc", "Stairway to Heaven", "Led Zeppelin", 482830, []demoSection{
+		{0, 54000, label("long intro")},
+		{343000, 404000, label("guitar solo")},
+	}},
+	{"40riOy7x9W7GXjyGp4pjAv", "Hotel California", "Eagles", 391376, []demoSection{
+		{0, 52000, label("long intro")},
+		{258000, 391376, label("outro solo")},
+	}},
+	{"5ghIJDpPoe3CfHMGu71E6T", "Smells Like Teen Spirit", "Nirvana", 301920, []demoSection{
+		{187000, 203000, nil},
+	}},
+	{"3n3Ppam7vgaVa1iaRUc9Lp", "Mr. Brightside", "The Killers", 222973, nil},
+}
+
+func main() {
+	userID := flag.String("user", "", "Spotify user ID to seed songs for; use your own to see them in the app")
+	flag.Parse()
+	if *userID == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Without a .env file the connection settings come from the environment alone
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Fatal("error: Error loading .env file: ", err)
+	}
+
+	ctx := context.Background()
+	// Connect the same way the server does
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		databaseURL = fmt.Sprintf("postgresql://%s:%s@%s:%s/%s",
+			os.Getenv("DBUSER"), os.Getenv("DBPASSWORD"), os.Getenv("DBHOST"), os.Getenv("DBPORT"), os.Getenv("DBNAME"))
+	}
+
+	conn, err := pgx.Connect(ctx, databaseURL)
+	if err != nil {
+		log.Fatalf("error: Unable to connect to database: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		log.Fatalf("error: Failed to start transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	created := 0
+	for _, song := range demoSongs {
+		tag, err := tx.Exec(ctx,
+			"INSERT INTO songs (song_id, user_id, title, artist, duration) VALUES ($1, $2, $3, $4, $5) ON CONFLICT DO NOTHING",
+			song.SongID, *userID, song.Title, song.Artist, song.Duration)
+		if err != nil {
+			log.Fatalf("error: Failed to insert song %s: %v", song.SongID, err)
+		}
+		// Existing songs keep whatever sections they have
+		if tag.RowsAffected() == 0 {
+			fmt.Printf("Skipped %s, it already exists\n", song.SongID)
+			continue
+		}
+
+		for _, section := range song.Sections {
+			_, err := tx.Exec(ctx,
+				"INSERT INTO skipped_sections (song_id, user_id, start_time, end_time, label) VALUES ($1, $2, $3, $4, $5)",
+				song.SongID, *userID, section.StartTime, section.EndTime, section.Label)
+			if err != nil {
+				log.Fatalf("error: Failed to insert skipped section for %s: %v", song.SongID, err)
+			}
+		}
+		created++
+		fmt.Printf("Added %s - %s with %d skipped sections\n", song.Artist, song.Title, len(song.Sections))
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Fatalf("error: Failed to commit demo data: %v", err)
+	}
+	fmt.Printf("Seeded %d of %d demo songs for user %s\n", created, len(demoSongs), *userID)
+}
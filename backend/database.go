@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// The connection pool, set up by dbConnection. Only the repository and the pool's own
+// lifecycle use it; handlers go through songRepo.
+var db *pgxpool.Pool
+
+// Returns DATABASE_URL as managed platforms provide it, or else builds the Postgres
+// connection URL from the DB* environment variables
+func databaseURL() string {
+	if url := os.Getenv("DATABASE_URL"); url != "" {
+		return url
+	}
+
+	databaseUser := os.Getenv("DBUSER")
+	databasePassword := os.Getenv("DBPASSWORD")
+	databaseName := os.Getenv("DBNAME")
+	databaseHost := os.Getenv("DBHOST")
+	databasePort := os.Getenv("DBPORT")
+
+	return fmt.Sprintf("postgresql://%s:%s@%s:%s/%s", databaseUser, databasePassword, databaseHost, databasePort, databaseName)
+}
+
+func dbConnection() {
+	databaseURL := databaseURL()
+
+	config, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		log.Fatalf("error: Invalid database configuration: %v: ", err)
+	}
+
+	// Keeping a few connections open avoids reconnecting on every burst of traffic
+	config.MaxConns = int32(intEnv("DB_MAX_CONNS", 10))
+	config.MinConns = int32(min(intEnv("DB_MIN_CONNS", 2), int(config.MaxConns)))
+
+	// The pool pings idle connections every health check period and replaces any that
+	// are broken, and recycles connections after their lifetime, so it recovers on its
+	// own once a restarted database is reachable again
+	config.HealthCheckPeriod = durationEnv("DB_HEALTH_CHECK_PERIOD", 15*time.Second)
+	config.MaxConnLifetime = durationEnv("DB_MAX_CONN_LIFETIME", time.Hour)
+	config.MaxConnIdleTime = durationEnv("DB_MAX_CONN_IDLE_TIME", 30*time.Minute)
+
+	// Prepare each query on first use and reuse the statement on that connection from then
+	// on. Poolers in transaction mode, such as PgBouncer, can't keep prepared statements,
+	// so DB_STATEMENT_CACHE_SIZE=0 falls back to sending each query unprepared.
+	config.ConnConfig.StatementCacheCapacity = intEnv("DB_STATEMENT_CACHE_SIZE", 512)
+	config.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+	if config.ConnConfig.StatementCacheCapacity <= 0 {
+		config.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeExec
+	}
+
+	slog.Info("database pool configured",
+		slog.Int("max_conns", int(config.MaxConns)),
+		slog.Int("min_conns", int(config.MinConns)),
+		slog.Duration("health_check_period", config.HealthCheckPeriod),
+		slog.Duration("max_conn_lifetime", config.MaxConnLifetime),
+		slog.Duration("max_conn_idle_time", config.MaxConnIdleTime),
+		slog.Int("statement_cache_size", config.ConnConfig.StatementCacheCapacity),
+		slog.String("query_exec_mode", config.ConnConfig.DefaultQueryExecMode.String()))
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		log.Fatalf("error: Unable to create database pool: %v: ", err)
+	}
+
+	// pgxpool connects lazily, so ping to make sure the database is reachable,
+	// backing off between attempts in case it is still starting up
+	maxAttempts := intEnv("DB_CONNECT_ATTEMPTS", 5)
+	maxDelay := durationEnv("DB_CONNECT_MAX_DELAY", 30*time.Second)
+	delay := time.Second
+	for attempt := 1; ; attempt++ {
+		err := pool.Ping(context.Background())
+		if err == nil {
+			break
+		}
+		if attempt >= maxAttempts {
+			log.Fatalf("error: Unable to connect to database after %d attempts: %v: ", attempt, err)
+		}
+
+		log.Printf("error: Database connection attempt %d of %d failed, retrying in %s: %v", attempt, maxAttempts, delay, err)
+		time.Sleep(delay)
+		delay = min(delay*2, maxDelay)
+	}
+	db = pool
+	songRepo = &pgSongRepository{db: pool}
+	fmt.Println("Connected to database successfully")
+}
+
+// Closes every connection of the pool, once nothing uses it anymore
+func closeDatabase() {
+	db.Close()
+}
+
+// Returns the pool's connection statistics, or nil before dbConnection
+func poolStat() *pgxpool.Stat {
+	if db == nil {
+		return nil
+	}
+	return db.Stat()
+}
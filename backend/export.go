@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Version of the document format written by exportData and read by importData
+const exportVersion = 1
+
+// Streams all of the user's songs with their skipped sections as one JSON document
+// that POST /import accepts. Songs are written as they are read, so large libraries
+// are never held in memory.
+//
+//	@Summary	Export all of the user's songs and skipped sections
+//	@Tags		songs
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Success	200	{object}	exportDocument
+//	@Router		/v1/export [get]
+func exportData(c *gin.Context) {
+	// Large exports can outlast QUERY_TIMEOUT, and requestTimeout leaves this route alone,
+	// so only the client going away stops them
+	ctx := c.Request.Context()
+
+	// The document is only started once the first song has been read, so a failing query
+	// can still be answered with an error
+	started := false
+	start := func() {
+		exportedAt, _ := json.Marshal(time.Now().UTC())
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="spotiskip-export.json"`)
+		c.Status(http.StatusOK)
+		fmt.Fprintf(c.Writer, `{"version":%d,"exported_at":%s,"songs":[`, exportVersion, exportedAt)
+		started = true
+	}
+
+	written := 0
+	err := songRepo.Export(ctx, currentUserID(c), func(song exportedSong) error {
+		if !started {
+			start()
+		}
+		payload, err := json.Marshal(song)
+		if err != nil {
+			return err
+		}
+		if written > 0 {
+			c.Writer.WriteString(",")
+		}
+		_, err = c.Writer.Write(payload)
+		written++
+		return err
+	})
+	if err != nil && !started {
+		respondError(c, http.StatusInternalServerError, "Failed to export songs: "+err.Error())
+		return
+	}
+	if err != nil {
+		exportFailed(c, err)
+		return
+	}
+	if !started {
+		start()
+	}
+
+	c.Writer.WriteString("]}")
+}
+
+// By the time an export fails the 200 status has been sent, so the failure is only logged.
+// The document is left unterminated, which clients reject as invalid JSON.
+func exportFailed(c *gin.Context, err error) {
+	slog.Error("export failed", slog.String("request_id", requestID(c)), slog.String("error", err.Error()))
+	c.Abort()
+}
+
+// Returns the song's sections without their enabled state, for validation
+func (s exportedSong) sectionInputs() []sectionInput {
+	inputs := make([]sectionInput, len(s.SkippedSections))
+	for i, section := range s.SkippedSections {
+		inputs[i] = section.sectionInput
+	}
+	return inputs
+}
+
+// Restores a document written by exportData in one transaction. In the default merge
+// mode songs the user already has are left as they are and reported as skipped; in
+// replace mode the user's whole library is deleted first and replaced by the document.
+// Documents may be up to MAX_IMPORT_BYTES rather than MAX_BODY_BYTES, so an export
+// larger than an ordinary request body can still be imported.
+//
+//	@Summary	Import songs and skipped sections from an export
+//	@Tags		songs
+//	@Accept		json
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		mode		query	string			false	"How to treat existing data (default merge)"	Enums(merge, replace)
+//	@Param		document	body	exportDocument	true	"A document written by GET /export"
+//	@Success	200	{object}	envelope{data=importResponse}
+//	@Failure	400	{object}	errorResponse
+//	@Failure	403	{object}	errorResponse
+//	@Failure	415	{object}	errorResponse
+//	@Router		/v1/import [post]
+func importData(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	mode := c.DefaultQuery("mode", "merge")
+	if mode != "merge" && mode != "replace" {
+		respondError(c, http.StatusBadRequest, "mode must be \"merge\" or \"replace\"")
+		return
+	}
+
+	var document exportDocument
+
+	if !bindJSON(c, &document) {
+		return
+	}
+	if document.Version != exportVersion {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("Unsupported export version %d, expected %d", document.Version, exportVersion))
+		return
+	}
+
+	// Validate the whole document before touching the database
+	seen := map[string]bool{}
+	for i, song := range document.Songs {
+		songID, err := normalizeSpotifyTrackID(song.SongID)
+		if err != nil {
+			respondErrorCode(c, http.StatusBadRequest, codeInvalidSongID, fmt.Sprintf("Invalid song at index %d: invalid song_id: %v", i, err))
+			return
+		}
+		if seen[songID] {
+			respondErrorCode(c, http.StatusBadRequest, codeDuplicateSong, fmt.Sprintf("Invalid song at index %d: song %s appears more than once", i, songID))
+			return
+		}
+		seen[songID] = true
+		document.Songs[i].SongID = songID
+		document.Songs[i].Title, document.Songs[i].Artist = normalizeText(song.Title), normalizeText(song.Artist)
+
+		if err := validateDuration(song.Duration); err != nil {
+			respondErrorCode(c, http.StatusBadRequest, codeInvalidDuration, fmt.Sprintf("Invalid song at index %d: %v", i, err))
+			return
+		}
+		if err := validateSectionInputs(song.sectionInputs(), song.Duration); err != nil {
+			respondErrorCode(c, http.StatusBadRequest, codeInvalidSection, fmt.Sprintf("Invalid song at index %d: %v", i, err))
+			return
+		}
+		if first, second, found := findOverlap(inputSections(song.sectionInputs())); found {
+			respondErrorCode(c, http.StatusBadRequest, codeSectionOverlap, fmt.Sprintf("Invalid song at index %d: skipped sections %s and %s overlap", i, first, second))
+			return
+		}
+	}
+
+	userID := currentUserID(c)
+
+	result, err := songRepo.Import(ctx, userID, document.Songs, mode == "replace")
+	switch {
+	case errors.Is(err, errSongQuotaExceeded):
+		respondErrorCode(c, http.StatusForbidden, codeSongQuotaExceeded, fmt.Sprintf("Song quota exceeded: at most %d songs can be stored per user, nothing was imported", maxSongsPerUser))
+		return
+	case errors.Is(err, errSectionQuotaExceeded):
+		respondErrorCode(c, http.StatusForbidden, codeSectionQuotaExceeded, fmt.Sprintf("Skipped section quota exceeded: at most %d skipped sections can be stored per user, nothing was imported", maxSectionsPerUser))
+		return
+	case err != nil:
+		respondError(c, http.StatusInternalServerError, "Failed to import, nothing was imported: "+err.Error())
+		return
+	}
+
+	respond(c, http.StatusOK, "Import completed successfully!", result)
+}
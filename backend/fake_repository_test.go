@@ -0,0 +1,266 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// In-memory SongRepository for handler tests. Only the methods the tests need are
+// implemented; the embedded interface is nil, so calling any other method panics.
+type fakeSongRepository struct {
+	SongRepository
+
+	mu            sync.Mutex
+	songs         map[fakeSongKey]*fakeSong
+	sections      map[int]*fakeSection
+	nextSectionID int
+}
+
+type fakeSongKey struct {
+	userID, songID string
+}
+
+type fakeSong struct {
+	song    storedSong
+	deleted bool
+}
+
+type fakeSection struct {
+	key     fakeSongKey
+	section skippedSection
+}
+
+func newFakeSongRepository() *fakeSongRepository {
+	return &fakeSongRepository{
+		songs:    map[fakeSongKey]*fakeSong{},
+		sections: map[int]*fakeSection{},
+	}
+}
+
+// Returns the song when it exists and isn't deleted. Callers hold r.mu.
+func (r *fakeSongRepository) liveSong(userID, songID string) (*fakeSong, bool) {
+	song, ok := r.songs[fakeSongKey{userID, songID}]
+	if !ok || song.deleted {
+		return nil, false
+	}
+	return song, true
+}
+
+// Returns a song's sections ordered by start time. Callers hold r.mu.
+func (r *fakeSongRepository) songSections(userID, songID string) []skippedSection {
+	sections := []skippedSection{}
+	for _, stored := range r.sections {
+		if stored.key == (fakeSongKey{userID, songID}) {
+			sections = append(sections, stored.section)
+		}
+	}
+	slices.SortFunc(sections, func(a, b skippedSection) int {
+		return cmp.Compare(a.StartTime, b.StartTime)
+	})
+	return sections
+}
+
+func (r *fakeSongRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (r *fakeSongRepository) GetByID(ctx context.Context, userID, songID string) (storedSong, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	song, ok := r.liveSong(userID, songID)
+	if !ok {
+		return storedSong{}, errSongNotFound
+	}
+	return song.song, nil
+}
+
+func (r *fakeSongRepository) GetDetails(ctx context.Context, userID, songID string) (songDetails, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	song, ok := r.liveSong(userID, songID)
+	if !ok {
+		return songDetails{}, errSongNotFound
+	}
+	return songDetails{
+		SongID:          song.song.SongID,
+		Title:           song.song.Title,
+		Artist:          song.song.Artist,
+		Duration:        song.song.Duration,
+		SkippedSections: r.songSections(userID, songID),
+	}, nil
+}
+
+func (r *fakeSongRepository) Exists(ctx context.Context, userID, songID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.liveSong(userID, songID)
+	return ok, nil
+}
+
+func (r *fakeSongRepository) Duration(ctx context.Context, userID, songID string) (*int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	song, ok := r.liveSong(userID, songID)
+	if !ok {
+		return nil, errSongNotFound
+	}
+	return song.song.Duration, nil
+}
+
+func (r *fakeSongRepository) FindDuplicate(ctx context.Context, userID, songID, title, artist string) (string, bool, error) {
+	if title == "" || artist == "" {
+		return "", false, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, song := range r.songs {
+		if key.userID == userID && key.songID != songID && !song.deleted &&
+			strings.EqualFold(song.song.Title, title) && strings.EqualFold(song.song.Artist, artist) {
+			return key.songID, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func (r *fakeSongRepository) CountOtherSongs(ctx context.Context, userID, songID string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for key := range r.songs {
+		if key.userID == userID && key.songID != songID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *fakeSongRepository) Insert(ctx context.Context, userID string, song songRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := fakeSongKey{userID, song.SongID}
+	if _, ok := r.songs[key]; ok {
+		return errSongExists
+	}
+	now := time.Now()
+	r.songs[key] = &fakeSong{song: storedSong{
+		SongID:    song.SongID,
+		Title:     song.Title,
+		Artist:    song.Artist,
+		Duration:  song.Duration,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}}
+	return nil
+}
+
+func (r *fakeSongRepository) AddSkippedSections(ctx context.Context, userID, songID string, sections []sectionInput, gap int) ([]skippedSection, []skippedSection, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	song, ok := r.liveSong(userID, songID)
+	if !ok {
+		return nil, nil, errSongNotFound
+	}
+	for i, section := range sections {
+		if err := validateSectionInput(section, song.song.Duration); err != nil {
+			return nil, nil, &invalidSectionError{index: i, err: err}
+		}
+	}
+	sections = mergeSections(dedupeSections(sections), gap)
+
+	existing := r.songSections(userID, songID)
+	sections, alreadyExisted := splitExistingSections(sections, existing)
+	if first, second, found := findOverlap(append(existing, inputSections(sections)...)); found {
+		return nil, nil, &sectionOverlapError{First: first, Second: second}
+	}
+
+	created := []skippedSection{}
+	for _, input := range sections {
+		r.nextSectionID++
+		section := skippedSection{
+			ID:        r.nextSectionID,
+			StartTime: input.StartTime,
+			EndTime:   input.EndTime,
+			Label:     input.Label,
+			Enabled:   true,
+			CreatedAt: time.Now(),
+		}
+		r.sections[section.ID] = &fakeSection{key: fakeSongKey{userID, songID}, section: section}
+		created = append(created, section)
+	}
+	return created, alreadyExisted, nil
+}
+
+func (r *fakeSongRepository) SkippedSections(ctx context.Context, userID, songID string) ([]skippedSection, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.songSections(userID, songID), nil
+}
+
+func (r *fakeSongRepository) DeleteSkippedSection(ctx context.Context, userID string, sectionID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.sections[sectionID]
+	if !ok || stored.key.userID != userID {
+		return errSectionNotFound
+	}
+	delete(r.sections, sectionID)
+	return nil
+}
+
+func (r *fakeSongRepository) SoftDelete(ctx context.Context, userID, songID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	song, ok := r.liveSong(userID, songID)
+	if !ok {
+		return errSongNotFound
+	}
+	song.deleted = true
+	return nil
+}
+
+func (r *fakeSongRepository) Restore(ctx context.Context, userID, songID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	song, ok := r.songs[fakeSongKey{userID, songID}]
+	if !ok || !song.deleted {
+		return errSongNotFound
+	}
+	song.deleted = false
+	return nil
+}
+
+func (r *fakeSongRepository) Search(ctx context.Context, userID, text string, limit, offset int) ([]storedSong, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	songs := []storedSong{}
+	for key, song := range r.songs {
+		lookupKey := strings.ToLower(song.song.Artist + " - " + song.song.Title)
+		if key.userID == userID && !song.deleted && strings.Contains(lookupKey, strings.ToLower(text)) {
+			songs = append(songs, song.song)
+		}
+	}
+	slices.SortFunc(songs, func(a, b storedSong) int {
+		return cmp.Compare(a.SongID, b.SongID)
+	})
+	totalCount := len(songs)
+	songs = songs[min(offset, totalCount):]
+	return songs[:min(limit, len(songs))], totalCount, nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	testToken  = "test-token"
+	testUserID = "test-user"
+	testSongID = "4uLU6hMCjMI75M1A2tKUQC"
+)
+
+// Builds the API router on top of repo, with testToken authenticating as testUserID
+// without calling Spotify
+func newTestRouter(t *testing.T, repo SongRepository) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	previous := songRepo
+	songRepo = repo
+	t.Cleanup(func() { songRepo = previous })
+
+	tokenCacheMu.Lock()
+	tokenCache[testToken] = cachedSpotifyUser{UserID: testUserID, ExpiresAt: time.Now().Add(time.Hour)}
+	tokenCacheMu.Unlock()
+	t.Cleanup(func() {
+		tokenCacheMu.Lock()
+		delete(tokenCache, testToken)
+		tokenCacheMu.Unlock()
+	})
+
+	r := gin.New()
+	registerAPIRoutes(r.Group("/v1"))
+	return r
+}
+
+// Sends an authenticated request, encoding body as JSON unless it is nil
+func doRequest(t *testing.T, r http.Handler, method, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatalf("encode request body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// Fails the test unless the response has the status, and for errors the code, expected
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, status int, code errorCode) {
+	t.Helper()
+
+	if w.Code != status {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, status, w.Body)
+	}
+	if code == "" {
+		return
+	}
+	var response errorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode error response: %v; body: %s", err, w.Body)
+	}
+	if response.Error.Code != code {
+		t.Fatalf("error code = %s, want %s; body: %s", response.Error.Code, code, w.Body)
+	}
+}
+
+// Decodes the data of a successful response into data
+func decodeData(t *testing.T, w *httptest.ResponseRecorder, data any) {
+	t.Helper()
+
+	if err := json.Unmarshal(w.Body.Bytes(), &envelope{Data: data}); err != nil {
+		t.Fatalf("decode response: %v; body: %s", err, w.Body)
+	}
+}
+
+func TestSongLifecycle(t *testing.T) {
+	repo := newFakeSongRepository()
+	r := newTestRouter(t, repo)
+
+	w := doRequest(t, r, http.MethodPost, "/v1/addSong", songRequest{SongID: testSongID, Title: "Never Gonna Give You Up", Artist: "Rick Astley"})
+	expectStatus(t, w, http.StatusOK, "")
+
+	// The same artist and title under another ID is stored too, pointing at the first song
+	w = doRequest(t, r, http.MethodPost, "/v1/addSong", songRequest{SongID: "7GhIk7Il098yCjg4BQjzvb", Title: "never gonna give you up", Artist: "RICK ASTLEY"})
+	expectStatus(t, w, http.StatusOK, "")
+	var added addSongResponse
+	decodeData(t, w, &added)
+	if added.PossibleDuplicateOf == nil || *added.PossibleDuplicateOf != testSongID {
+		t.Fatalf("possible_duplicate_of = %v, want %s", added.PossibleDuplicateOf, testSongID)
+	}
+
+	// The same ID can't be added twice
+	w = doRequest(t, r, http.MethodPost, "/v1/addSong", songRequest{SongID: testSongID, Title: "Never Gonna Give You Up", Artist: "Rick Astley"})
+	expectStatus(t, w, http.StatusConflict, codeDuplicateSong)
+
+	// Song IDs in the path may be URIs too
+	w = doRequest(t, r, http.MethodGet, "/v1/getSong/spotify:track:"+testSongID, nil)
+	expectStatus(t, w, http.StatusOK, "")
+	var got struct {
+		Song storedSong `json:"song"`
+	}
+	decodeData(t, w, &got)
+	if got.Song.SongID != testSongID || got.Song.Artist != "Rick Astley" {
+		t.Fatalf("got song %+v", got.Song)
+	}
+
+	w = doRequest(t, r, http.MethodDelete, "/v1/deleteSong/"+testSongID, nil)
+	expectStatus(t, w, http.StatusOK, "")
+	w = doRequest(t, r, http.MethodGet, "/v1/getSong/"+testSongID, nil)
+	expectStatus(t, w, http.StatusNotFound, codeSongNotFound)
+
+	w = doRequest(t, r, http.MethodPost, "/v1/songs/"+testSongID+"/restore", nil)
+	expectStatus(t, w, http.StatusOK, "")
+	w = doRequest(t, r, http.MethodGet, "/v1/getSong/"+testSongID, nil)
+	expectStatus(t, w, http.StatusOK, "")
+
+	w = doRequest(t, r, http.MethodGet, "/v1/getSong/not-a-track", nil)
+	expectStatus(t, w, http.StatusBadRequest, codeInvalidSongID)
+}
+
+func TestSkippedSections(t *testing.T) {
+	repo := newFakeSongRepository()
+	r := newTestRouter(t, repo)
+
+	w := doRequest(t, r, http.MethodPost, "/v1/addSkippedSections", addSkippedSectionsRequest{SongID: testSongID, SkippedSections: []sectionInput{{StartTime: 0, EndTime: 1000}}})
+	expectStatus(t, w, http.StatusNotFound, codeSongNotFound)
+
+	duration := 60000
+	w = doRequest(t, r, http.MethodPost, "/v1/addSong", songRequest{SongID: testSongID, Title: "Title", Artist: "Artist", Duration: &duration})
+	expectStatus(t, w, http.StatusOK, "")
+
+	w = doRequest(t, r, http.MethodPost, "/v1/addSkippedSections", addSkippedSectionsRequest{SongID: testSongID, SkippedSections: []sectionInput{{StartTime: 10000, EndTime: 20000}}})
+	expectStatus(t, w, http.StatusOK, "")
+	var added struct {
+		SkippedSections []skippedSection `json:"skipped_sections"`
+	}
+	decodeData(t, w, &added)
+	if len(added.SkippedSections) != 1 {
+		t.Fatalf("added %d sections, want 1", len(added.SkippedSections))
+	}
+
+	w = doRequest(t, r, http.MethodPost, "/v1/addSkippedSections", addSkippedSectionsRequest{SongID: testSongID, SkippedSections: []sectionInput{{StartTime: 15000, EndTime: 25000}}})
+	expectStatus(t, w, http.StatusBadRequest, codeSectionOverlap)
+
+	w = doRequest(t, r, http.MethodPost, "/v1/addSkippedSections", addSkippedSectionsRequest{SongID: testSongID, SkippedSections: []sectionInput{{StartTime: 50000, EndTime: 70000}}})
+	expectStatus(t, w, http.StatusBadRequest, codeInvalidSection)
+
+	w = doRequest(t, r, http.MethodGet, "/v1/getSongDetails/"+testSongID, nil)
+	expectStatus(t, w, http.StatusOK, "")
+	var details struct {
+		Song songDetails `json:"song"`
+	}
+	decodeData(t, w, &details)
+	if len(details.Song.SkippedSections) != 1 || details.Song.TotalSkippedMs != 10000 || details.Song.TotalSkippedSeconds != 10 {
+		t.Fatalf("got details %+v", details.Song)
+	}
+
+	path := fmt.Sprintf("/v1/skippedSection/%d", added.SkippedSections[0].ID)
+	w = doRequest(t, r, http.MethodDelete, path, nil)
+	expectStatus(t, w, http.StatusOK, "")
+	w = doRequest(t, r, http.MethodDelete, path, nil)
+	expectStatus(t, w, http.StatusNotFound, codeSectionNotFound)
+}
+
+// A song without sections is found, with an empty list rather than null or an error
+func TestSongDetailsWithoutSections(t *testing.T) {
+	r := newTestRouter(t, newFakeSongRepository())
+
+	w := doRequest(t, r, http.MethodPost, "/v1/addSong", songRequest{SongID: testSongID, Title: "Title", Artist: "Artist"})
+	expectStatus(t, w, http.StatusOK, "")
+
+	w = doRequest(t, r, http.MethodGet, "/v1/getSongDetails/"+testSongID, nil)
+	expectStatus(t, w, http.StatusOK, "")
+	if !strings.Contains(w.Body.String(), `"skipped_sections":[]`) {
+		t.Fatalf("want an empty skipped_sections list, got %s", w.Body)
+	}
+}
+
+func TestSkipAtAndValidateSections(t *testing.T) {
+	r := newTestRouter(t, newFakeSongRepository())
+
+	duration := 60000
+	w := doRequest(t, r, http.MethodPost, "/v1/addSong", songRequest{SongID: testSongID, Title: "Title", Artist: "Artist", Duration: &duration})
+	expectStatus(t, w, http.StatusOK, "")
+	w = doRequest(t, r, http.MethodPost, "/v1/addSkippedSections", addSkippedSectionsRequest{SongID: testSongID, SkippedSections: []sectionInput{{StartTime: 10000, EndTime: 20000}}})
+	expectStatus(t, w, http.StatusOK, "")
+
+	w = doRequest(t, r, http.MethodGet, "/v1/songs/"+testSongID+"/skipAt?position=15000", nil)
+	expectStatus(t, w, http.StatusOK, "")
+	var skip skipAtResponse
+	decodeData(t, w, &skip)
+	if skip.SeekTo != 20000 {
+		t.Fatalf("seek_to = %d, want 20000", skip.SeekTo)
+	}
+	w = doRequest(t, r, http.MethodGet, "/v1/songs/"+testSongID+"/skipAt?position=30000", nil)
+	expectStatus(t, w, http.StatusNoContent, "")
+
+	w = doRequest(t, r, http.MethodPost, "/v1/skippedSections/validate", addSkippedSectionsRequest{SongID: testSongID, SkippedSections: []sectionInput{{StartTime: 15000, EndTime: 25000}}})
+	expectStatus(t, w, http.StatusOK, "")
+	var validation validateSectionsResponse
+	decodeData(t, w, &validation)
+	if validation.Valid || len(validation.Issues) != 1 {
+		t.Fatalf("got validation %+v, want one overlap issue", validation)
+	}
+}
+
+func TestSearchQueryLength(t *testing.T) {
+	r := newTestRouter(t, newFakeSongRepository())
+
+	w := doRequest(t, r, http.MethodPost, "/v1/addSong", songRequest{SongID: testSongID, Title: strings.Repeat("é", maxSearchQueryLength), Artist: "Artist"})
+	expectStatus(t, w, http.StatusOK, "")
+
+	// The limit counts characters, so a query of multi-byte letters may use all of it
+	w = doRequest(t, r, http.MethodGet, "/v1/searchSongs?q="+url.QueryEscape(strings.Repeat("é", maxSearchQueryLength)), nil)
+	expectStatus(t, w, http.StatusOK, "")
+	var found songListResponse
+	decodeData(t, w, &found)
+	if len(found.Songs) != 1 {
+		t.Fatalf("search found %+v, want the song", found.Songs)
+	}
+
+	w = doRequest(t, r, http.MethodGet, "/v1/searchSongs?q="+url.QueryEscape(strings.Repeat("é", maxSearchQueryLength+1)), nil)
+	expectStatus(t, w, http.StatusBadRequest, "")
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMergeSections(t *testing.T) {
+	intro, outro := "intro", "outro"
+
+	tests := []struct {
+		name     string
+		sections []sectionInput
+		gap      int
+		want     []sectionInput
+	}{
+		{
+			name:     "single section",
+			sections: []sectionInput{{StartTime: 0, EndTime: 1000}},
+			gap:      500,
+			want:     []sectionInput{{StartTime: 0, EndTime: 1000}},
+		},
+		{
+			name:     "negative gap leaves sections alone",
+			sections: []sectionInput{{StartTime: 2000, EndTime: 3000}, {StartTime: 0, EndTime: 2500}},
+			gap:      -1,
+			want:     []sectionInput{{StartTime: 2000, EndTime: 3000}, {StartTime: 0, EndTime: 2500}},
+		},
+		{
+			name:     "overlapping sections are sorted and merged",
+			sections: []sectionInput{{StartTime: 2000, EndTime: 3000}, {StartTime: 0, EndTime: 2500}},
+			gap:      0,
+			want:     []sectionInput{{StartTime: 0, EndTime: 3000}},
+		},
+		{
+			name:     "contained section keeps the outer end",
+			sections: []sectionInput{{StartTime: 0, EndTime: 5000}, {StartTime: 1000, EndTime: 2000}},
+			gap:      0,
+			want:     []sectionInput{{StartTime: 0, EndTime: 5000}},
+		},
+		{
+			name:     "sections within the gap are merged",
+			sections: []sectionInput{{StartTime: 0, EndTime: 1000}, {StartTime: 1500, EndTime: 2000}},
+			gap:      500,
+			want:     []sectionInput{{StartTime: 0, EndTime: 2000}},
+		},
+		{
+			name:     "sections beyond the gap stay apart",
+			sections: []sectionInput{{StartTime: 0, EndTime: 1000}, {StartTime: 1501, EndTime: 2000}},
+			gap:      500,
+			want:     []sectionInput{{StartTime: 0, EndTime: 1000}, {StartTime: 1501, EndTime: 2000}},
+		},
+		{
+			name:     "merged section keeps the first label",
+			sections: []sectionInput{{StartTime: 0, EndTime: 1000}, {StartTime: 500, EndTime: 2000, Label: &intro}, {StartTime: 1500, EndTime: 3000, Label: &outro}},
+			gap:      0,
+			want:     []sectionInput{{StartTime: 0, EndTime: 3000, Label: &intro}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := mergeSections(test.sections, test.gap); !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("mergeSections = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMergeSectionsLeavesInputUnchanged(t *testing.T) {
+	sections := []sectionInput{{StartTime: 2000, EndTime: 3000}, {StartTime: 0, EndTime: 2500}}
+	mergeSections(sections, 0)
+	if sections[0].StartTime != 2000 || sections[0].EndTime != 3000 {
+		t.Fatalf("input changed to %+v", sections)
+	}
+}
+
+func TestFindOverlap(t *testing.T) {
+	tests := []struct {
+		name     string
+		sections []skippedSection
+		want     [2]int // IDs of the overlapping pair, zero when there is none
+	}{
+		{
+			name:     "no sections",
+			sections: nil,
+		},
+		{
+			name:     "touching sections do not overlap",
+			sections: []skippedSection{{ID: 1, StartTime: 0, EndTime: 1000}, {ID: 2, StartTime: 1000, EndTime: 2000}},
+		},
+		{
+			name:     "overlap found regardless of order",
+			sections: []skippedSection{{ID: 1, StartTime: 5000, EndTime: 6000}, {ID: 2, StartTime: 1000, EndTime: 2000}, {ID: 3, StartTime: 1500, EndTime: 2500}},
+			want:     [2]int{2, 3},
+		},
+		{
+			name:     "contained section overlaps",
+			sections: []skippedSection{{ID: 1, StartTime: 0, EndTime: 5000}, {ID: 2, StartTime: 1000, EndTime: 2000}},
+			want:     [2]int{1, 2},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			first, second, found := findOverlap(test.sections)
+			if want := test.want != [2]int{}; found != want {
+				t.Fatalf("found = %t, want %t", found, want)
+			}
+			if found && [2]int{first.ID, second.ID} != test.want {
+				t.Fatalf("overlap between %d and %d, want %v", first.ID, second.ID, test.want)
+			}
+		})
+	}
+}
+
+func TestSplitExistingSections(t *testing.T) {
+	existing := []skippedSection{
+		{ID: 1, StartTime: 0, EndTime: 1000},
+		{ID: 2, StartTime: 5000, EndTime: 6000},
+	}
+	sections := []sectionInput{
+		{StartTime: 5000, EndTime: 6000},
+		{StartTime: 0, EndTime: 1500},
+		{StartTime: 0, EndTime: 1000},
+	}
+
+	remaining, alreadyExisted := splitExistingSections(sections, existing)
+	if want := []sectionInput{{StartTime: 0, EndTime: 1500}}; !reflect.DeepEqual(remaining, want) {
+		t.Fatalf("remaining = %+v, want %+v", remaining, want)
+	}
+	if len(alreadyExisted) != 2 || alreadyExisted[0].ID != 2 || alreadyExisted[1].ID != 1 {
+		t.Fatalf("already existed = %+v, want sections 2 and 1", alreadyExisted)
+	}
+
+	remaining, alreadyExisted = splitExistingSections([]sectionInput{{StartTime: 0, EndTime: 1000}}, nil)
+	if len(remaining) != 1 || len(alreadyExisted) != 0 {
+		t.Fatalf("with nothing stored got %+v and %+v", remaining, alreadyExisted)
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	want := pageCursor{SongID: testSongID, Sort: "title", Value: "Never Gonna Give You Up", CreatedAt: &createdAt}
+
+	got, err := parseCursor(cursorContext(*encodeCursor(want)))
+	if err != nil {
+		t.Fatalf("parse cursor: %v", err)
+	}
+	if got.SongID != want.SongID || got.Sort != want.Sort || got.Value != want.Value || !got.CreatedAt.Equal(createdAt) {
+		t.Fatalf("cursor = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseCursor(t *testing.T) {
+	cursor, err := parseCursor(cursorContext(""))
+	if cursor != nil || err != nil {
+		t.Fatalf("without a cursor got %+v, %v; want nil, nil", cursor, err)
+	}
+
+	for _, value := range []string{"not base64!", "bm90IGpzb24", *encodeCursor(pageCursor{Sort: "title"})} {
+		if _, err := parseCursor(cursorContext(value)); err == nil {
+			t.Errorf("cursor %q was accepted", value)
+		}
+	}
+}
+
+// Returns a request context carrying value as its cursor query parameter
+func cursorContext(value string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/v1/getSongs?cursor="+url.QueryEscape(value), nil)
+	return c
+}
+
+func TestRequestFingerprint(t *testing.T) {
+	fingerprint := requestFingerprint(http.MethodPost, "/addSong", []byte(`{"song_id":"a"}`))
+	if fingerprint != requestFingerprint(http.MethodPost, "/addSong", []byte(`{"song_id":"a"}`)) {
+		t.Fatal("the same request gave different fingerprints")
+	}
+
+	others := map[string]string{
+		"method": requestFingerprint(http.MethodPut, "/addSong", []byte(`{"song_id":"a"}`)),
+		"route":  requestFingerprint(http.MethodPost, "/addSongs", []byte(`{"song_id":"a"}`)),
+		"body":   requestFingerprint(http.MethodPost, "/addSong", []byte(`{"song_id":"b"}`)),
+	}
+	for name, other := range others {
+		if other == fingerprint {
+			t.Errorf("a different %s gave the same fingerprint", name)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How long a response is kept for replay under its Idempotency-Key
+var idempotencyTTL = 24 * time.Hour
+
+// Most keys remembered at once; beyond it the responses closest to expiring are forgotten
+var maxIdempotencyKeys = 10000
+
+const maxIdempotencyKeyLength = 255
+
+// A response recorded under an Idempotency-Key. Until the first request finishes it is
+// pending, and a replay of the key is refused rather than run a second time.
+type idempotentResponse struct {
+	fingerprint string
+	pending     bool
+	status      int
+	contentType string
+	body        []byte
+	expiresAt   time.Time
+}
+
+// Responses of write requests that carried an Idempotency-Key, keyed by user and key
+var idempotencyKeys = struct {
+	sync.Mutex
+	responses map[string]*idempotentResponse
+}{responses: map[string]*idempotentResponse{}}
+
+// Makes a write route safe to retry. When a request carries an Idempotency-Key header,
+// its response is remembered for idempotencyTTL and sent again, instead of running the
+// handler, when the same user replays the key. Reusing a key for a different request,
+// or while the first is still running, is refused with 409. Server errors are not
+// remembered, so the request can be retried. Must run after authRequired.
+func idempotent(c *gin.Context) {
+	key := c.GetHeader("Idempotency-Key")
+	if key == "" || idempotencyTTL <= 0 {
+		c.Next()
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		abortWithError(c, http.StatusBadRequest, fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength))
+		return
+	}
+
+	// The body is part of what makes two requests the same, so read it up front and hand
+	// the handler a copy
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			abortWithError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit))
+			return
+		}
+		abortWithErrorCode(c, http.StatusBadRequest, codeInvalidBody, "Invalid request: "+err.Error())
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	fingerprint := requestFingerprint(c.Request.Method, unversionedRoute(c), body)
+	storeKey := currentUserID(c) + "\n" + key
+
+	idempotencyKeys.Lock()
+	recorded, ok := idempotencyKeys.responses[storeKey]
+	if ok && time.Now().After(recorded.expiresAt) {
+		ok = false
+	}
+	if !ok {
+		if len(idempotencyKeys.responses) >= maxIdempotencyKeys {
+			evictIdempotencyKey()
+		}
+		idempotencyKeys.responses[storeKey] = &idempotentResponse{
+			fingerprint: fingerprint,
+			pending:     true,
+			expiresAt:   time.Now().Add(idempotencyTTL),
+		}
+	}
+	var replay idempotentResponse
+	if ok {
+		replay = *recorded
+	}
+	idempotencyKeys.Unlock()
+
+	if ok {
+		switch {
+		case replay.fingerprint != fingerprint:
+			abortWithErrorCode(c, http.StatusConflict, codeIdempotencyKeyReused, "Idempotency-Key was already used for a different request")
+		case replay.pending:
+			abortWithErrorCode(c, http.StatusConflict, codeIdempotencyKeyReused, "A request with this Idempotency-Key is still being processed")
+		default:
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(replay.status, replay.contentType, replay.body)
+			c.Abort()
+		}
+		return
+	}
+
+	writer := &recordingResponseWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	defer func() {
+		c.Writer = writer.ResponseWriter
+
+		idempotencyKeys.Lock()
+		defer idempotencyKeys.Unlock()
+		// No status was set when the handler panicked; recovery answers 500 afterwards.
+		// Written can't tell, since gzipMiddleware holds back small responses until the end.
+		status := writer.status
+		if status == 0 || status >= http.StatusInternalServerError {
+			delete(idempotencyKeys.responses, storeKey)
+			return
+		}
+		idempotencyKeys.responses[storeKey] = &idempotentResponse{
+			fingerprint: fingerprint,
+			status:      status,
+			contentType: writer.Header().Get("Content-Type"),
+			body:        writer.body.Bytes(),
+			expiresAt:   time.Now().Add(idempotencyTTL),
+		}
+	}()
+	c.Next()
+}
+
+// Identifies a request by its method, route and body, so a key replayed for a
+// different request is told apart. Callers pass the route without its version
+// prefix, so a request matches whether it was sent to /v1 or not.
+func requestFingerprint(method, route string, body []byte) string {
+	hash := sha256.Sum256(append([]byte(method+" "+route+"\n"), body...))
+	return hex.EncodeToString(hash[:])
+}
+
+// Keeps a copy of everything written to the response, and the status the handler set
+type recordingResponseWriter struct {
+	gin.ResponseWriter
+	body   bytes.Buffer
+	status int
+}
+
+func (w *recordingResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingResponseWriter) WriteString(data string) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+// Makes room for a new key by dropping expired responses, or else the recorded response
+// closest to expiring. Pending keys are kept so a running request is never run twice.
+// Must be called with idempotencyKeys locked.
+func evictIdempotencyKey() {
+	now := time.Now()
+	var oldestKey string
+	var oldest *idempotentResponse
+	for key, response := range idempotencyKeys.responses {
+		if now.After(response.expiresAt) {
+			delete(idempotencyKeys.responses, key)
+			continue
+		}
+		if !response.pending && (oldest == nil || response.expiresAt.Before(oldest.expiresAt)) {
+			oldestKey, oldest = key, response
+		}
+	}
+	if len(idempotencyKeys.responses) >= maxIdempotencyKeys && oldest != nil {
+		delete(idempotencyKeys.responses, oldestKey)
+	}
+}
+
+// Forgets expired idempotency keys every interval until ctx is cancelled
+func runIdempotencySweep(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			idempotencyKeys.Lock()
+			for key, response := range idempotencyKeys.responses {
+				if now.After(response.expiresAt) {
+					delete(idempotencyKeys.responses, key)
+				}
+			}
+			idempotencyKeys.Unlock()
+		}
+	}
+}
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/jackc/pgx/v5"
+)
+
+// Integration tests run against the Postgres database in TEST_DATABASE_URL and are
+// skipped when it isn't set. They drop and recreate the whole schema, so point it at
+// a database used for nothing else.
+func integrationDatabase(t *testing.T) {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	t.Setenv("DATABASE_URL", url)
+}
+
+// Migrates a fresh schema and connects the pool and repository to it
+func integrationRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	integrationDatabase(t)
+
+	m := testMigrator(t)
+	if err := m.Down(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		t.Fatalf("migrate down: %v", err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+
+	previous := db
+	dbConnection()
+	t.Cleanup(func() {
+		db.Close()
+		db = previous
+	})
+
+	r := newTestRouter(t, songRepo)
+	r.GET("/health", healthCheck)
+	return r
+}
+
+func testMigrator(t *testing.T) *migrate.Migrate {
+	t.Helper()
+
+	m, err := newMigrator()
+	if err != nil {
+		t.Fatalf("initialize migrations: %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+// Returns the version of the newest embedded migration
+func latestMigrationVersion(t *testing.T) uint {
+	t.Helper()
+
+	files, err := fs.Glob(migrationFiles, "migrations/*.up.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("list migrations: %v", err)
+	}
+	name := strings.TrimPrefix(files[len(files)-1], "migrations/")
+	prefix, _, _ := strings.Cut(name, "_")
+	version, err := strconv.ParseUint(prefix, 10, 64)
+	if err != nil {
+		t.Fatalf("parse migration version of %s: %v", name, err)
+	}
+	return uint(version)
+}
+
+// Reports whether every table the server uses exists
+func tablesExist(t *testing.T) bool {
+	t.Helper()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, databaseURL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	var exists bool
+	err = conn.QueryRow(ctx, `SELECT to_regclass('songs') IS NOT NULL
+		AND to_regclass('skipped_sections') IS NOT NULL
+		AND to_regclass('skip_events') IS NOT NULL`).Scan(&exists)
+	if err != nil {
+		t.Fatalf("check tables: %v", err)
+	}
+	return exists
+}
+
+func TestMigrationsUpAndDown(t *testing.T) {
+	integrationDatabase(t)
+	m := testMigrator(t)
+
+	if err := m.Down(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		t.Fatalf("migrate down: %v", err)
+	}
+	if tablesExist(t) {
+		t.Fatal("tables still exist after migrating down")
+	}
+
+	testMillisecondsMigration(t, m)
+
+	if err := m.Up(); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	version, dirty, err := m.Version()
+	if err != nil || dirty || version != latestMigrationVersion(t) {
+		t.Fatalf("version = %d, dirty = %t, err = %v; want %d", version, dirty, err, latestMigrationVersion(t))
+	}
+	if !tablesExist(t) {
+		t.Fatal("tables missing after migrating up")
+	}
+
+	// Every down migration must undo its up migration cleanly, one step at a time
+	for version > 0 {
+		if err := m.Steps(-1); err != nil {
+			t.Fatalf("migrate down from version %d: %v", version, err)
+		}
+		version, _, err = m.Version()
+		if errors.Is(err, migrate.ErrNilVersion) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read version: %v", err)
+		}
+	}
+	if tablesExist(t) {
+		t.Fatal("tables still exist after stepping down every migration")
+	}
+
+	// A database whose tables predate migration tracking is baselined rather than
+	// having its tables created a second time
+	if err := m.Steps(2); err != nil {
+		t.Fatalf("migrate to version 2: %v", err)
+	}
+	execSQL(t, `INSERT INTO songs (user_id, song_id) VALUES ('user', 'song') RETURNING created_at;
+		TRUNCATE schema_migrations`)
+	baselineMigrations(m, 2)
+	if err := m.Up(); err != nil {
+		t.Fatalf("migrate up after baseline: %v", err)
+	}
+}
+
+// Migration 000008 converts times stored in seconds to milliseconds exactly once, and
+// its down migration restores the seconds exactly
+func testMillisecondsMigration(t *testing.T, m *migrate.Migrate) {
+	t.Helper()
+
+	if err := m.Migrate(7); err != nil {
+		t.Fatalf("migrate to version 7: %v", err)
+	}
+	execSQL(t, `INSERT INTO songs (user_id, song_id, duration) VALUES ('user', 'song', 213);
+		INSERT INTO skipped_sections (user_id, song_id, start_time, end_time) VALUES ('user', 'song', 30, 45)`)
+
+	if err := m.Migrate(8); err != nil {
+		t.Fatalf("migrate to version 8: %v", err)
+	}
+	expectStoredTimes(t, 213000, 30000, 45000)
+
+	// Applying the conversion again, as forcing the version back would, changes nothing
+	up, err := fs.ReadFile(migrationFiles, "migrations/000008_use_milliseconds.up.sql")
+	if err != nil {
+		t.Fatalf("read migration: %v", err)
+	}
+	execSQL(t, string(up))
+	expectStoredTimes(t, 213000, 30000, 45000)
+
+	if err := m.Migrate(7); err != nil {
+		t.Fatalf("migrate back to version 7: %v", err)
+	}
+	expectStoredTimes(t, 213, 30, 45)
+
+	// Values already in milliseconds are left alone even without the marker comment
+	execSQL(t, `UPDATE songs SET duration = 213000; UPDATE skipped_sections SET start_time = 30000, end_time = 45000`)
+	if err := m.Migrate(8); err != nil {
+		t.Fatalf("migrate to version 8 again: %v", err)
+	}
+	expectStoredTimes(t, 213000, 30000, 45000)
+}
+
+// Runs statements, possibly several, on a connection of its own
+func execSQL(t *testing.T, sql string) {
+	t.Helper()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, databaseURL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	if _, err := conn.Exec(ctx, sql, pgx.QueryExecModeSimpleProtocol); err != nil {
+		t.Fatalf("exec %q: %v", sql, err)
+	}
+}
+
+// Fails the test unless the one stored song and section have these times
+func expectStoredTimes(t *testing.T, duration, startTime, endTime int) {
+	t.Helper()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, databaseURL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	var gotDuration, gotStart, gotEnd int
+	err = conn.QueryRow(ctx, `SELECT s.duration, ss.start_time, ss.end_time
+		FROM songs s JOIN skipped_sections ss ON ss.user_id = s.user_id AND ss.song_id = s.song_id`).
+		Scan(&gotDuration, &gotStart, &gotEnd)
+	if err != nil {
+		t.Fatalf("read times: %v", err)
+	}
+	if gotDuration != duration || gotStart != startTime || gotEnd != endTime {
+		t.Fatalf("stored times = %d, %d-%d; want %d, %d-%d", gotDuration, gotStart, gotEnd, duration, startTime, endTime)
+	}
+}
+
+func TestIntegrationSongs(t *testing.T) {
+	r := integrationRouter(t)
+
+	duration := 213573
+	w := doRequest(t, r, http.MethodPost, "/v1/addSong", songRequest{SongID: testSongID, Title: "Never Gonna Give You Up", Artist: "Rick Astley", Duration: &duration})
+	expectStatus(t, w, http.StatusOK, "")
+
+	w = doRequest(t, r, http.MethodPost, "/v1/addSong", songRequest{SongID: testSongID, Title: "Never Gonna Give You Up", Artist: "Rick Astley"})
+	expectStatus(t, w, http.StatusConflict, codeDuplicateSong)
+
+	// Searching matches the lowercased "artist - title"
+	w = doRequest(t, r, http.MethodGet, "/v1/searchSongs?q="+url.QueryEscape("ASTLEY - never"), nil)
+	expectStatus(t, w, http.StatusOK, "")
+	var found struct {
+		Songs []storedSong `json:"songs"`
+	}
+	decodeData(t, w, &found)
+	if len(found.Songs) != 1 || found.Songs[0].SongID != testSongID {
+		t.Fatalf("search found %+v", found.Songs)
+	}
+
+	// Another ID with the same artist and title is stored, reported as a possible duplicate
+	w = doRequest(t, r, http.MethodPost, "/v1/addSong", songRequest{SongID: "7GhIk7Il098yCjg4BQjzvb", Title: "never gonna  give you up", Artist: "RICK ASTLEY"})
+	expectStatus(t, w, http.StatusOK, "")
+	var added addSongResponse
+	decodeData(t, w, &added)
+	if added.PossibleDuplicateOf == nil || *added.PossibleDuplicateOf != testSongID {
+		t.Fatalf("possible_duplicate_of = %v, want %s", added.PossibleDuplicateOf, testSongID)
+	}
+
+	w = doRequest(t, r, http.MethodGet, "/v1/getSong/"+testSongID, nil)
+	expectStatus(t, w, http.StatusOK, "")
+	var got struct {
+		Song storedSong `json:"song"`
+	}
+	decodeData(t, w, &got)
+	if got.Song.Title != "Never Gonna Give You Up" || got.Song.Duration == nil || *got.Song.Duration != duration {
+		t.Fatalf("got song %+v", got.Song)
+	}
+
+	title, artist := "Together Forever", "Rick Astley"
+	w = doRequest(t, r, http.MethodPut, "/v1/songs/"+testSongID, songReplaceRequest{Title: &title, Artist: &artist})
+	expectStatus(t, w, http.StatusOK, "")
+	w = doRequest(t, r, http.MethodGet, "/v1/getSong/"+testSongID, nil)
+	decodeData(t, w, &got)
+	if got.Song.Title != title || got.Song.Duration != nil {
+		t.Fatalf("got song %+v after replacing it", got.Song)
+	}
+
+	newTitle := "Together Forever (Remastered)"
+	w = doRequest(t, r, http.MethodPatch, "/v1/songs/"+testSongID, songUpdateRequest{Title: &newTitle})
+	expectStatus(t, w, http.StatusOK, "")
+
+	w = doRequest(t, r, http.MethodDelete, "/v1/deleteSong/"+testSongID, nil)
+	expectStatus(t, w, http.StatusOK, "")
+	w = doRequest(t, r, http.MethodGet, "/v1/getSong/"+testSongID, nil)
+	expectStatus(t, w, http.StatusNotFound, codeSongNotFound)
+	w = doRequest(t, r, http.MethodPatch, "/v1/songs/"+testSongID, songUpdateRequest{Title: &newTitle})
+	expectStatus(t, w, http.StatusNotFound, codeSongNotFound)
+
+	w = doRequest(t, r, http.MethodPost, "/v1/songs/"+testSongID+"/restore", nil)
+	expectStatus(t, w, http.StatusOK, "")
+	w = doRequest(t, r, http.MethodGet, "/v1/getSong/"+testSongID, nil)
+	decodeData(t, w, &got)
+	if got.Song.Title != newTitle {
+		t.Fatalf("got song %+v after restoring it", got.Song)
+	}
+}
+
+func TestIntegrationSkippedSections(t *testing.T) {
+	r := integrationRouter(t)
+
+	duration := 60000
+	w := doRequest(t, r, http.MethodPost, "/v1/addSong", songRequest{SongID: testSongID, Title: "Title", Artist: "Artist", Duration: &duration})
+	expectStatus(t, w, http.StatusOK, "")
+
+	w = doRequest(t, r, http.MethodPost, "/v1/addSkippedSections", addSkippedSectionsRequest{SongID: testSongID, SkippedSections: []sectionInput{
+		{StartTime: 0, EndTime: 10000},
+		{StartTime: 30000, EndTime: 40000},
+	}})
+	expectStatus(t, w, http.StatusOK, "")
+	var added struct {
+		SkippedSections []skippedSection `json:"skipped_sections"`
+	}
+	decodeData(t, w, &added)
+	if len(added.SkippedSections) != 2 {
+		t.Fatalf("added %d sections, want 2", len(added.SkippedSections))
+	}
+	first := added.SkippedSections[0].ID
+
+	w = doRequest(t, r, http.MethodPost, "/v1/addSkippedSections", addSkippedSectionsRequest{SongID: testSongID, SkippedSections: []sectionInput{{StartTime: 5000, EndTime: 15000}}})
+	expectStatus(t, w, http.StatusBadRequest, codeSectionOverlap)
+
+	path := fmt.Sprintf("/v1/skippedSection/%d", first)
+	w = doRequest(t, r, http.MethodPut, path, sectionInput{StartTime: 2000, EndTime: 12000})
+	expectStatus(t, w, http.StatusOK, "")
+	w = doRequest(t, r, http.MethodPut, path, sectionInput{StartTime: 25000, EndTime: 35000})
+	expectStatus(t, w, http.StatusBadRequest, codeSectionOverlap)
+	w = doRequest(t, r, http.MethodPut, path, sectionInput{StartTime: 50000, EndTime: 70000})
+	expectStatus(t, w, http.StatusBadRequest, codeInvalidSection)
+	w = doRequest(t, r, http.MethodPut, "/v1/skippedSection/999999", sectionInput{StartTime: 0, EndTime: 1000})
+	expectStatus(t, w, http.StatusNotFound, codeSectionNotFound)
+
+	w = doRequest(t, r, http.MethodGet, "/v1/getSongDetails/"+testSongID, nil)
+	expectStatus(t, w, http.StatusOK, "")
+	var details struct {
+		Song songDetails `json:"song"`
+	}
+	decodeData(t, w, &details)
+	if len(details.Song.SkippedSections) != 2 || details.Song.SkippedSections[0].StartTime != 2000 {
+		t.Fatalf("got details %+v", details.Song)
+	}
+
+	w = doRequest(t, r, http.MethodDelete, path, nil)
+	expectStatus(t, w, http.StatusOK, "")
+	w = doRequest(t, r, http.MethodDelete, path, nil)
+	expectStatus(t, w, http.StatusNotFound, codeSectionNotFound)
+
+	w = doRequest(t, r, http.MethodDelete, "/v1/songs/"+testSongID+"/skippedSections", nil)
+	expectStatus(t, w, http.StatusOK, "")
+	var cleared deletedCountResponse
+	decodeData(t, w, &cleared)
+	if cleared.DeletedCount != 1 {
+		t.Fatalf("cleared %d sections, want 1", cleared.DeletedCount)
+	}
+}
+
+func TestIntegrationErrorCodes(t *testing.T) {
+	r := integrationRouter(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/getSongs", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	expectStatus(t, w, http.StatusUnauthorized, codeMissingToken)
+
+	w = doRequest(t, r, http.MethodGet, "/v1/getSong/not-a-track", nil)
+	expectStatus(t, w, http.StatusBadRequest, codeInvalidSongID)
+
+	w = doRequest(t, r, http.MethodGet, "/v1/getSongDetails/"+testSongID, nil)
+	expectStatus(t, w, http.StatusNotFound, codeSongNotFound)
+
+	w = doRequest(t, r, http.MethodPost, "/v1/addSong", map[string]any{"title": "No ID"})
+	expectStatus(t, w, http.StatusBadRequest, codeValidationFailed)
+
+	duration := -1
+	w = doRequest(t, r, http.MethodPost, "/v1/addSong", songRequest{SongID: testSongID, Title: "Title", Artist: "Artist", Duration: &duration})
+	expectStatus(t, w, http.StatusBadRequest, codeInvalidDuration)
+
+	w = doRequest(t, r, http.MethodGet, "/v1/getSongs?limit=-1", nil)
+	expectStatus(t, w, http.StatusBadRequest, codeInvalidPagination)
+
+	w = doRequest(t, r, http.MethodPut, "/v1/skippedSection/abc", sectionInput{StartTime: 0, EndTime: 1000})
+	expectStatus(t, w, http.StatusBadRequest, codeInvalidSectionID)
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/addSong", strings.NewReader("{"))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	expectStatus(t, w, http.StatusBadRequest, codeInvalidBody)
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/addSong", strings.NewReader("song_id="+testSongID))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	expectStatus(t, w, http.StatusUnsupportedMediaType, codeUnsupportedMediaType)
+}
+
+// Terminating every connection of the pool, as a database restart or failover does,
+// must only fail the requests in flight: the pool replaces broken connections and
+// the server answers again without being restarted
+func TestIntegrationRecoversFromDroppedConnections(t *testing.T) {
+	t.Setenv("DB_HEALTH_CHECK_PERIOD", "100ms")
+	r := integrationRouter(t)
+
+	w := doRequest(t, r, http.MethodPost, "/v1/addSong", songRequest{SongID: testSongID, Title: "Title", Artist: "Artist"})
+	expectStatus(t, w, http.StatusOK, "")
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, databaseURL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	var terminated int
+	err = conn.QueryRow(ctx, `SELECT COUNT(pg_terminate_backend(pid)) FROM pg_stat_activity
+		WHERE datname = current_database() AND pid <> pg_backend_pid()`).Scan(&terminated)
+	if err != nil {
+		t.Fatalf("terminate connections: %v", err)
+	}
+	if terminated == 0 {
+		t.Fatal("no pool connections to terminate")
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		w = doRequest(t, r, http.MethodGet, "/v1/getSong/"+testSongID, nil)
+		if w.Code == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not recover after its connections were terminated: %d %s", w.Code, w.Body)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	w = doRequest(t, r, http.MethodGet, "/health", nil)
+	expectStatus(t, w, http.StatusOK, "")
+}
+
+func TestIntegrationSongDetailsWithoutSections(t *testing.T) {
+	r := integrationRouter(t)
+
+	w := doRequest(t, r, http.MethodPost, "/v1/addSong", songRequest{SongID: testSongID, Title: "Title", Artist: "Artist"})
+	expectStatus(t, w, http.StatusOK, "")
+
+	w = doRequest(t, r, http.MethodGet, "/v1/getSongDetails/"+testSongID, nil)
+	expectStatus(t, w, http.StatusOK, "")
+	if !strings.Contains(w.Body.String(), `"skipped_sections":[]`) {
+		t.Fatalf("want an empty skipped_sections list, got %s", w.Body)
+	}
+}
+
+// Concurrent adds to the same song are serialized by the song's row lock, so overlapping
+// sections sent at the same time can't both be stored, nor can both of two adds that
+// together exceed the section quota
+func TestIntegrationConcurrentSectionAdds(t *testing.T) {
+	r := integrationRouter(t)
+
+	duration := 60000
+	w := doRequest(t, r, http.MethodPost, "/v1/addSong", songRequest{SongID: testSongID, Title: "Title", Artist: "Artist", Duration: &duration})
+	expectStatus(t, w, http.StatusOK, "")
+
+	// Every request overlaps every other, so exactly one may succeed
+	const requests = 10
+	statuses := addSectionsConcurrently(t, r, requests, func(i int) sectionInput {
+		return sectionInput{StartTime: i * 100, EndTime: 5000 + i*100}
+	})
+	if statuses[http.StatusOK] != 1 || statuses[http.StatusBadRequest] != requests-1 {
+		t.Fatalf("got statuses %v, want one 200 and %d 400", statuses, requests-1)
+	}
+
+	previous := maxSectionsPerUser
+	maxSectionsPerUser = 2
+	t.Cleanup(func() { maxSectionsPerUser = previous })
+
+	// One section is stored, so only one of these disjoint sections fits under the quota
+	statuses = addSectionsConcurrently(t, r, 2, func(i int) sectionInput {
+		return sectionInput{StartTime: 20000 + i*10000, EndTime: 25000 + i*10000}
+	})
+	if statuses[http.StatusOK] != 1 || statuses[http.StatusForbidden] != 1 {
+		t.Fatalf("got statuses %v, want one 200 and one 403", statuses)
+	}
+}
+
+// Sends n addSkippedSections requests for testSongID at once, the i-th adding section(i),
+// and counts the responses by status
+func addSectionsConcurrently(t *testing.T, r http.Handler, n int, section func(i int) sectionInput) map[int]int {
+	t.Helper()
+
+	requests := make([]*http.Request, n)
+	for i := range requests {
+		body, err := json.Marshal(addSkippedSectionsRequest{SongID: testSongID, SkippedSections: []sectionInput{section(i)}})
+		if err != nil {
+			t.Fatalf("encode request body: %v", err)
+		}
+		requests[i] = httptest.NewRequest(http.MethodPost, "/v1/addSkippedSections", bytes.NewReader(body))
+		requests[i].Header.Set("Authorization", "Bearer "+testToken)
+		requests[i].Header.Set("Content-Type", "application/json")
+	}
+
+	codes := make([]int, n)
+	var wg sync.WaitGroup
+	for i, req := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			codes[i] = w.Code
+		}()
+	}
+	wg.Wait()
+
+	statuses := map[int]int{}
+	for _, code := range codes {
+		statuses[code]++
+	}
+	return statuses
+}
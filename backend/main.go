@@ -1,303 +1,2866 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
+	"log/slog"
+	"maps"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
-	"github.com/jackc/pgx/v5"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-var db *pgx.Conn
+var queryTimeout = 5 * time.Second
+
+// Query deadlines for routes whose latency budget differs from queryTimeout, keyed by
+// the route without its version prefix. Single-song reads should fail fast, while bulk
+// writes may legitimately take longer. QUERY_TIMEOUTS overrides or adds entries.
+var routeQueryTimeouts = map[string]time.Duration{
+	"/getSong/:id":             2 * time.Second,
+	"/getSongDetails/:id":      2 * time.Second,
+	"/songs/:id/skipAt":        2 * time.Second,
+	"/addSongs":                30 * time.Second,
+	"/addSkippedSectionsBatch": 30 * time.Second,
+	"/deleteSongs":             30 * time.Second,
+	"/import":                  time.Minute,
+	"/admin/cleanup":           time.Minute,
+}
 
 func init() {
+	// The file is optional, so the environment alone can configure the server, as it does
+	// in tests; validateConfig reports anything still missing
 	err := godotenv.Load()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Fatal("error: Error loading .env file: ", err)
+	}
+}
+
+//go:generate go run github.com/swaggo/swag/cmd/swag@v1.16.4 init --parseDependency=false --outputTypes json,yaml --output docs
+
+// Starts the Spotiskip API server
+//
+//	@title						Spotiskip API
+//	@version					1.0
+//	@description				Stores the sections of Spotify tracks each user wants to skip.
+//	@BasePath					/
+//	@securityDefinitions.apikey	SpotifyToken
+//	@in							header
+//	@name						Authorization
+//	@description				Spotify access token as "Bearer <token>".
+func main() {
+	// Log as JSON so production logs can be aggregated
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+
+	// Debug mode only for local development, so production logs stay clean
+	gin.SetMode(ginMode())
+
+	// Background jobs run until shutdown begins
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	var jobs sync.WaitGroup
+
+	r := gin.New()
+	r.Use(requestLogger, metricsMiddleware, recovery)
+
+	// Only believe X-Forwarded-For from the configured proxies, so clients can't choose the
+	// IP they are rate limited and logged under; none are trusted by default
+	if err := r.SetTrustedProxies(envList("TRUSTED_PROXIES")); err != nil {
+		log.Fatal("error: Invalid TRUSTED_PROXIES: ", err)
+	}
+
+	// Routes are case-sensitive and have no trailing slash. Near misses such as
+	// /getSongs/ or /GetSongs are redirected to the canonical path (301 for GET,
+	// 307 otherwise so the method and body are kept) instead of answering 404.
+	r.RedirectTrailingSlash = true
+	r.RedirectFixedPath = true
+
+	// Match routes on the escaped path so a song ID given as a percent-encoded
+	// open.spotify.com URL stays a single path parameter
+	r.UseRawPath = true
+
+	// Answer known paths called with the wrong method with 405 and an Allow header
+	r.HandleMethodNotAllowed = true
+	r.NoMethod(methodNotAllowed)
+
+	// Allow browser clients from configured origins
+	r.Use(corsMiddleware())
+
+	// Compress larger responses for clients that accept gzip
+	r.Use(gzipMiddleware(intEnv("GZIP_MIN_SIZE", 1024)))
+
+	// Throttle each client IP, unless disabled with a non-positive RATE_LIMIT_RPS
+	if rps := floatEnv("RATE_LIMIT_RPS", 10); rps > 0 {
+		r.Use(rateLimiter(jobsCtx, rps, intEnv("RATE_LIMIT_BURST", 20)))
+	}
+
+	// Cap request bodies so a huge payload can't exhaust memory while being bound. Imports
+	// carry a whole export document, so they get a limit of their own.
+	r.Use(bodyLimit(int64(intEnv("MAX_BODY_BYTES", 1<<20)), map[string]int64{
+		"/import": int64(intEnv("MAX_IMPORT_BYTES", 32<<20)),
+	}))
+
+	// Backstop so no request can run forever; a non-positive REQUEST_TIMEOUT disables it
+	if timeout := durationEnv("REQUEST_TIMEOUT", 15*time.Second); timeout > 0 {
+		r.Use(requestTimeout(timeout))
+	}
+
+	// Tell clients which API version answered, and refuse versions asked for that we don't speak
+	r.Use(apiVersionNegotiation)
+
+	// Fail fast with a clear message when required settings are missing
+	if err := validateConfig(); err != nil {
+		log.Fatal("error: Invalid configuration: ", err)
+	}
+
+	// Deadline applied to the database work of each request
+	queryTimeout = durationEnv("QUERY_TIMEOUT", queryTimeout)
+	maps.Copy(routeQueryTimeouts, routeTimeoutsEnv("QUERY_TIMEOUTS"))
+
+	// Gap within which submitted skipped sections are merged
+	defaultMergeGap = intEnv("MERGE_GAP", defaultMergeGap)
+
+	// How long responses are kept for Idempotency-Key replays; non-positive disables them
+	idempotencyTTL = durationEnv("IDEMPOTENCY_TTL", idempotencyTTL)
+	maxIdempotencyKeys = intEnv("IDEMPOTENCY_MAX_KEYS", maxIdempotencyKeys)
+
+	// Refuse every change to the data, for maintenance windows and read replicas
+	readOnly = os.Getenv("READ_ONLY") == "true"
+	if readOnly {
+		slog.Warn("read-only mode enabled, write endpoints answer 503")
+	}
+
+	// Storage limits for each user
+	maxSongsPerUser = intEnv("MAX_SONGS_PER_USER", maxSongsPerUser)
+	maxSectionsPerUser = intEnv("MAX_SECTIONS_PER_USER", maxSectionsPerUser)
+
+	// Connect to the database
+	dbConnection()
+
+	// Apply pending schema migrations when enabled
+	if os.Getenv("RUN_MIGRATIONS") == "true" {
+		runMigrations()
+	}
+
+	// Configure Spotify OAuth
+	spotifyAuthConfig()
+
+	// Name fields in validation errors as clients send them
+	setupValidator()
+
+	// Test route
+	r.GET("/ping", ping)
+
+	// Prometheus metrics
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	// OpenAPI spec and Swagger UI. The spec is generated, not checked in, so say so up
+	// front rather than leave /docs/swagger.json answering 404 unexplained.
+	if _, err := os.Stat("docs/swagger.json"); err != nil {
+		slog.Warn("docs/swagger.json not found, run go generate in backend/ to serve the API docs")
+	}
+	r.StaticFile("/docs/swagger.json", "docs/swagger.json")
+	r.GET("/docs", swaggerUI)
+
+	// Build information of the running server
+	r.GET("/version", versionInfo)
+
+	// Usage totals for analytics; they span every user, so only admins may see them
+	r.GET("/stats", authRequired, adminRequired, getStats)
+
+	// Readiness check that verifies the database is reachable
+	r.GET("/health", healthCheck)
+
+	// The API is versioned by path prefix. The unversioned paths are the original routes,
+	// kept for existing clients, and serve the same version as /v1.
+	registerAPIRoutes(r.Group("/v1"))
+	registerAPIRoutes(r.Group(""))
+
+	// Periodically delete skipped sections left without a song; a non-positive CLEANUP_INTERVAL
+	// disables it, as does READ_ONLY
+	if interval := durationEnv("CLEANUP_INTERVAL", time.Hour); interval > 0 && !readOnly {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			runCleanup(jobsCtx, interval)
+		}()
+	}
+
+	// Follow changes to skip data announced by Postgres. Replicas can't LISTEN, so it is
+	// off with READ_ONLY.
+	if !readOnly {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			listenForSkipChanges(jobsCtx)
+		}()
+	}
+
+	// Forget validated Spotify tokens once they expire
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		runTokenCacheSweep(jobsCtx, time.Minute)
+	}()
+
+	// Forget idempotency keys once they expire
+	if idempotencyTTL > 0 {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			runIdempotencySweep(jobsCtx, time.Minute)
+		}()
+	}
+
+	// Start the server on port 8080 on every interface, unless BIND_ADDR (or HOST)
+	// restricts it, for example to 127.0.0.1 behind a sidecar proxy
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	host := cmp.Or(os.Getenv("BIND_ADDR"), os.Getenv("HOST"), "0.0.0.0")
+	addr := net.JoinHostPort(host, port)
+	server := &http.Server{
+		Addr:    addr,
+		Handler: r,
+	}
+
+	// Serve HTTPS, with HTTP/2 negotiated automatically, when a certificate is configured
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	useTLS := certFile != "" && keyFile != ""
+	if useTLS {
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	go func() {
+		var err error
+		if useTLS {
+			fmt.Println("Server running with TLS on", addr)
+			err = server.ListenAndServeTLS(certFile, keyFile)
+		} else {
+			fmt.Println("Server running on", addr)
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("error: Server failed: %v", err)
+		}
+	}()
+
+	// Wait for an interrupt or SIGTERM before draining in-flight requests
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+
+	shutdownTimeout := durationEnv("SHUTDOWN_TIMEOUT", 10*time.Second)
+
+	fmt.Println("Shutting down server...")
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("error: Server forced to shut down: %v", err)
+	}
+	stopJobs()
+	jobs.Wait()
+	closeDatabase()
+	fmt.Printf("Server stopped after draining for %.1f seconds\n", time.Since(start).Seconds())
+}
+
+// Registers every versioned API route on router
+func registerAPIRoutes(router *gin.RouterGroup) {
+	// Exchange a Spotify authorization code for tokens
+	router.POST("/auth/callback", authCallback)
+
+	// Every route below requires a valid Spotify bearer token. Routes that change data
+	// also go through writable, so they can be switched off with READ_ONLY.
+	api := router.Group("")
+	api.Use(authRequired)
+
+	// Add a new song; replays of an Idempotency-Key get the first response back
+	api.POST("/addSong", writable, idempotent, addSong)
+
+	// Add many songs at once
+	api.POST("/addSongs", writable, addSongs)
+
+	// Add skipped sections to a song; replays of an Idempotency-Key get the first response back
+	api.POST("/addSkippedSections", writable, idempotent, addSkippedSections)
+
+	// Add skipped sections to many songs at once
+	api.POST("/addSkippedSectionsBatch", writable, addSkippedSectionsBatch)
+
+	// Get song by ID
+	api.GET("/getSong/:id", getSong)
+
+	// Get song with skipped sections by ID
+	api.GET("/getSongDetails/:id", getSongDetails)
+
+	// Get details of many songs at once, keyed by song ID
+	api.POST("/getSongDetailsBatch", getSongDetailsBatch)
+
+	// Get all songs
+	api.GET("/getSongs", getSongs)
+
+	// Get only the IDs of all songs
+	api.GET("/songIds", getSongIDs)
+
+	// Search songs by title or artist
+	api.GET("/searchSongs", searchSongs)
+
+	// Get every skipped section of the user's songs, keyed by song ID
+	api.GET("/skipMap", getSkipMap)
+
+	// Replace a song by ID
+	api.PUT("/updateSong/:id", writable, replaceSong)
+
+	// Replace a song, or update only some of its fields
+	api.PUT("/songs/:id", writable, replaceSong)
+	api.PATCH("/songs/:id", writable, patchSong)
+
+	// Delete a song by ID
+	api.DELETE("/deleteSong/:id", writable, deleteSong)
+
+	// Delete many songs at once
+	api.POST("/deleteSongs", writable, deleteSongs)
+
+	// Leaderboard of the songs with the most skipped time across all users
+	api.GET("/songs/mostSkipped", getMostSkippedSongs)
+
+	// Restore a deleted song
+	api.POST("/songs/:id/restore", writable, restoreSong)
+
+	// Replace all skipped sections of a song
+	api.PUT("/songs/:id/skippedSections", writable, replaceSkippedSections)
+
+	// Longest, shortest and average skipped sections of the user
+	api.GET("/skippedSections/stats", getSectionStats)
+
+	// Check proposed skipped sections without saving them
+	api.POST("/skippedSections/validate", validateSkippedSections)
+
+	// Set the display order of a song's skipped sections
+	api.PUT("/songs/:id/skippedSections/order", writable, reorderSkippedSections)
+
+	// Remove every skipped section of a song, keeping the song
+	api.DELETE("/songs/:id/skippedSections", writable, clearSkippedSections)
+
+	// Merge a duplicate song into another
+	api.POST("/songs/:id/merge", writable, mergeSongs)
+
+	// Update a single skipped section by ID
+	api.PUT("/skippedSection/:id", writable, updateSkippedSection)
+
+	// Enable or disable a single skipped section by ID
+	api.PATCH("/skippedSection/:id/toggle", writable, toggleSkippedSection)
+
+	// Delete a single skipped section by ID
+	api.DELETE("/skippedSection/:id", writable, deleteSkippedSection)
+
+	// Record a skip the player performed
+	api.POST("/skipEvents", writable, addSkipEvent)
+
+	// Get when the user's skip data last changed
+	api.GET("/skipChanges/latest", getLatestSkipChange)
+
+	// Stream changes to the user's skip data as Server-Sent Events
+	api.GET("/skipStream", skipStream)
+
+	// Get the skipped section at a playback position, if any
+	api.GET("/songs/:id/skipAt", getSkipAt)
+
+	// Get the skips recorded for a song
+	api.GET("/songs/:id/skipEvents", getSkipEvents)
+
+	// Download all of the user's data
+	api.GET("/export", exportData)
+
+	// Restore data from an export
+	api.POST("/import", writable, importData)
+
+	// Admin-only maintenance routes
+	admin := api.Group("/admin")
+	admin.Use(adminRequired)
+
+	// List songs that have no skipped sections
+	admin.GET("/songsWithoutSkips", getSongsWithoutSkips)
+
+	// Delete orphaned skipped sections now instead of waiting for the background job
+	admin.POST("/cleanup", writable, cleanupOrphans)
+}
+
+// Environment variables the server can't start without, unless DATABASE_URL replaces them
+var requiredEnvVars = []string{"DBUSER", "DBPASSWORD", "DBNAME", "DBHOST", "DBPORT"}
+
+// Checks that all required environment variables are set, reporting every problem at once
+func validateConfig() error {
+	var problems []string
+
+	if url := os.Getenv("DATABASE_URL"); url != "" {
+		if _, err := pgxpool.ParseConfig(url); err != nil {
+			problems = append(problems, "invalid DATABASE_URL: "+err.Error())
+		}
+	} else {
+		var missing []string
+		for _, name := range requiredEnvVars {
+			if os.Getenv(name) == "" {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			problems = append(problems, "missing required environment variables, or DATABASE_URL: "+strings.Join(missing, ", "))
+		}
+
+		if port := os.Getenv("DBPORT"); port != "" {
+			if _, err := strconv.Atoi(port); err != nil {
+				problems = append(problems, fmt.Sprintf("DBPORT must be numeric, got %q", port))
+			}
+		}
+	}
+
+	// TLS needs both halves of the key pair, and both must be readable
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if (certFile == "") != (keyFile == "") {
+		problems = append(problems, "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	} else if certFile != "" {
+		if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+			problems = append(problems, "invalid TLS certificate or key: "+err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Reads a duration such as "10s" from the environment, falling back to the default when unset or invalid
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("error: Invalid %s %q, using %s: %v", name, value, fallback, err)
+		return fallback
+	}
+	return parsed
+}
+
+// Reads a comma-separated list from the environment, dropping empty entries
+func envList(name string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Reads route=duration pairs separated by commas from the environment, as in
+// /import=2m,/getSong/:id=1s, skipping entries that aren't a positive duration
+func routeTimeoutsEnv(name string) map[string]time.Duration {
+	timeouts := map[string]time.Duration{}
+	for _, entry := range envList(name) {
+		route, value, _ := strings.Cut(entry, "=")
+		timeout, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || timeout <= 0 {
+			log.Printf("error: Invalid %s entry %q, ignoring it: expected route=duration", name, entry)
+			continue
+		}
+		timeouts[strings.TrimSpace(route)] = timeout
+	}
+	return timeouts
+}
+
+// Reads an integer from the environment, falling back to the default when unset or invalid
+func intEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("error: Invalid %s %q, using %d: %v", name, value, fallback, err)
+		return fallback
+	}
+	return parsed
+}
+
+// Reads a decimal number from the environment, falling back to the default when unset or invalid
+func floatEnv(name string, fallback float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("error: Invalid %s %q, using %g: %v", name, value, fallback, err)
+		return fallback
+	}
+	return parsed
+}
+
+// Derives a database context from the request so client disconnects cancel queries, bounded by
+// the route's entry in routeQueryTimeouts or else queryTimeout
+func queryContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	timeout, ok := routeQueryTimeouts[unversionedRoute(c)]
+	if !ok {
+		timeout = queryTimeout
+	}
+	return context.WithTimeout(c.Request.Context(), timeout)
+}
+
+// Test route
+//
+//	@Summary	Liveness check
+//	@Tags		system
+//	@Produce	json
+//	@Success	200	{object}	envelope
+//	@Router		/ping [get]
+func ping(c *gin.Context) {
+	respond(c, http.StatusOK, "Pong!", nil)
+}
+
+// Reports that the path exists but not for this method; gin has already set the Allow header
+func methodNotAllowed(c *gin.Context) {
+	respondError(c, http.StatusMethodNotAllowed, "Method "+c.Request.Method+" not allowed, use "+c.Writer.Header().Get("Allow"))
+}
+
+// Reports whether the server can reach the database
+//
+//	@Summary	Readiness check that pings the database
+//	@Tags		system
+//	@Produce	json
+//	@Success	200	{object}	envelope{data=healthResponse}
+//	@Failure	503	{object}	errorResponse
+//	@Router		/health [get]
+func healthCheck(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+	defer cancel()
+
+	if err := songRepo.Ping(ctx); err != nil {
+		respondError(c, http.StatusServiceUnavailable, "Database unreachable: "+err.Error())
+		return
+	}
+
+	respond(c, http.StatusOK, "", healthResponse{Status: "ok", DB: "up"})
+}
+
+// Add skipped sections to a song
+//
+//	@Summary	Add skipped sections to a song
+//	@Tags		sections
+//	@Accept		json
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		request	body	addSkippedSectionsRequest	true	"Sections to add, in milliseconds; merge_gap overrides the merge tolerance, negative disables merging"
+//	@Success	200	{object}	envelope{data=addSkippedSectionsResponse}
+//	@Failure	400	{object}	errorResponse
+//	@Failure	403	{object}	errorResponse
+//	@Failure	404	{object}	errorResponse
+//	@Failure	415	{object}	errorResponse
+//	@Router		/v1/addSkippedSections [post]
+func addSkippedSections(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	var request addSkippedSectionsRequest
+
+	// Bind JSON request to struct
+	if !bindJSON(c, &request) {
+		return
+	}
+	if len(request.SkippedSections) > maxSkippedSections {
+		respondErrorCode(c, http.StatusRequestEntityTooLarge, codeTooManySections, fmt.Sprintf("At most %d skipped sections can be sent at once", maxSkippedSections))
+		return
+	}
+
+	songID, ok := songIDBody(c, request.SongID)
+	if !ok {
+		return
+	}
+	request.SongID = songID
+
+	created, alreadyExisted, err := songRepo.AddSkippedSections(ctx, currentUserID(c), request.SongID, request.SkippedSections, mergeGapOrDefault(request.MergeGap))
+	var invalid *invalidSectionError
+	var overlap *sectionOverlapError
+	switch {
+	case errors.Is(err, errSongNotFound):
+		respondErrorCode(c, http.StatusNotFound, codeSongNotFound, "Song not found")
+		return
+	case errors.As(err, &invalid):
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidSection, invalid.Error())
+		return
+	case errors.As(err, &overlap):
+		respondErrorCode(c, http.StatusBadRequest, codeSectionOverlap, overlap.Error())
+		return
+	case errors.Is(err, errSectionQuotaExceeded):
+		respondErrorCode(c, http.StatusForbidden, codeSectionQuotaExceeded, fmt.Sprintf("Skipped section quota exceeded: at most %d skipped sections can be stored per user", maxSectionsPerUser))
+		return
+	case err != nil:
+		respondError(c, http.StatusInternalServerError, "Failed to add skipped sections: "+err.Error())
+		return
+	}
+
+	respond(c, http.StatusOK, "Skipped sections added successfully!", gin.H{
+		"skipped_sections": created,
+		"already_existed":  alreadyExisted})
+}
+
+// Runs the checks of addSkippedSections against proposed sections without saving anything
+//
+//	@Summary	Validate skipped sections without saving them
+//	@Tags		sections
+//	@Accept		json
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		request	body	addSkippedSectionsRequest	true	"Sections to check, as they would be sent to addSkippedSections"
+//	@Success	200	{object}	envelope{data=validateSectionsResponse}
+//	@Failure	400	{object}	errorResponse
+//	@Failure	404	{object}	errorResponse
+//	@Failure	415	{object}	errorResponse
+//	@Router		/v1/skippedSections/validate [post]
+func validateSkippedSections(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	var request addSkippedSectionsRequest
+
+	if !bindJSON(c, &request) {
+		return
+	}
+	if len(request.SkippedSections) > maxSkippedSections {
+		respondErrorCode(c, http.StatusRequestEntityTooLarge, codeTooManySections, fmt.Sprintf("At most %d skipped sections can be sent at once", maxSkippedSections))
+		return
+	}
+
+	songID, ok := songIDBody(c, request.SongID)
+	if !ok {
+		return
+	}
+	request.SongID = songID
+
+	userID := currentUserID(c)
+
+	duration, err := songRepo.Duration(ctx, userID, request.SongID)
+	if errors.Is(err, errSongNotFound) {
+		respondErrorCode(c, http.StatusNotFound, codeSongNotFound, "Song not found")
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to check if song exists: "+err.Error())
+		return
+	}
+
+	existing, err := songRepo.SkippedSections(ctx, userID, request.SongID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve existing skipped sections: "+err.Error())
+		return
+	}
+
+	issues := sectionIssues(request.SkippedSections, duration, existing, mergeGapOrDefault(request.MergeGap))
+
+	respond(c, http.StatusOK, "Skipped sections validated successfully!", gin.H{
+		"valid":  len(issues) == 0,
+		"issues": issues})
+}
+
+// Replace every skipped section of a song with the provided list
+//
+//	@Summary	Replace all skipped sections of a song
+//	@Tags		sections
+//	@Accept		json
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		id	path	string	true	"Song ID"
+//	@Param		request	body	replaceSkippedSectionsRequest	true	"The complete new list of sections"
+//	@Success	200	{object}	envelope{data=skippedSectionsResponse}
+//	@Failure	400	{object}	errorResponse
+//	@Failure	403	{object}	errorResponse
+//	@Failure	404	{object}	errorResponse
+//	@Failure	415	{object}	errorResponse
+//	@Router		/v1/songs/{id}/skippedSections [put]
+func replaceSkippedSections(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	songID, ok := songIDParam(c)
+	if !ok {
+		return
+	}
+
+	var request replaceSkippedSectionsRequest
+
+	if !bindJSON(c, &request) {
+		return
+	}
+	if len(request.SkippedSections) > maxSkippedSections {
+		respondErrorCode(c, http.StatusRequestEntityTooLarge, codeTooManySections, fmt.Sprintf("At most %d skipped sections can be sent at once", maxSkippedSections))
+		return
+	}
+
+	userID := currentUserID(c)
+
+	duration, err := songRepo.Duration(ctx, userID, songID)
+	if errors.Is(err, errSongNotFound) {
+		respondErrorCode(c, http.StatusNotFound, codeSongNotFound, "Song not found")
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to check if song exists: "+err.Error())
+		return
+	}
+
+	// Validate every section up front so one bad section rejects the whole list
+	if err := validateSectionInputs(request.SkippedSections, duration); err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidSection, err.Error())
+		return
+	}
+
+	request.SkippedSections = mergeSections(dedupeSections(request.SkippedSections), mergeGapOrDefault(request.MergeGap))
+
+	// Only the new list matters for overlaps since the stored sections are being replaced
+	if first, second, found := findOverlap(inputSections(request.SkippedSections)); found {
+		respondErrorCode(c, http.StatusBadRequest, codeSectionOverlap, fmt.Sprintf("Skipped sections %s and %s overlap", first, second))
+		return
+	}
+
+	created, err := songRepo.ReplaceSkippedSections(ctx, userID, songID, request.SkippedSections)
+	if errors.Is(err, errSectionQuotaExceeded) {
+		respondErrorCode(c, http.StatusForbidden, codeSectionQuotaExceeded, fmt.Sprintf("Skipped section quota exceeded: at most %d skipped sections can be stored per user", maxSectionsPerUser))
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to replace skipped sections: "+err.Error())
+		return
+	}
+
+	respond(c, http.StatusOK, "Skipped sections replaced successfully!", gin.H{"skipped_sections": created})
+}
+
+// Sets the display order of a song's skipped sections, for editors that let users arrange
+// them freely. The body must list every section of the song exactly once; sections are
+// then returned in this order instead of by start time.
+//
+//	@Summary	Reorder the skipped sections of a song
+//	@Tags		sections
+//	@Accept		json
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		id	path	string	true	"Song ID"
+//	@Param		request	body	reorderSectionsRequest	true	"Every section ID of the song, in display order"
+//	@Success	200	{object}	envelope{data=skippedSectionsResponse}
+//	@Failure	400	{object}	errorResponse
+//	@Failure	404	{object}	errorResponse
+//	@Failure	415	{object}	errorResponse
+//	@Router		/v1/songs/{id}/skippedSections/order [put]
+func reorderSkippedSections(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	songID, ok := songIDParam(c)
+	if !ok {
+		return
+	}
+
+	var request reorderSectionsRequest
+
+	if !bindJSON(c, &request) {
+		return
+	}
+
+	sections, err := songRepo.ReorderSkippedSections(ctx, currentUserID(c), songID, request.SectionIDs)
+	var invalidOrder *sectionOrderError
+	if errors.Is(err, errSongNotFound) {
+		respondErrorCode(c, http.StatusNotFound, codeSongNotFound, "Song not found")
+		return
+	}
+	if errors.As(err, &invalidOrder) {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidSectionID, invalidOrder.Error())
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to reorder skipped sections: "+err.Error())
+		return
+	}
+
+	respond(c, http.StatusOK, "Skipped sections reordered successfully!", gin.H{"skipped_sections": sections})
+}
+
+// Removes all skipped sections of a song while keeping the song itself
+//
+//	@Summary	Clear all skipped sections of a song
+//	@Tags		sections
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		id	path	string	true	"Song ID"
+//	@Success	200	{object}	envelope{data=deletedCountResponse}
+//	@Failure	400	{object}	errorResponse
+//	@Failure	404	{object}	errorResponse
+//	@Router		/v1/songs/{id}/skippedSections [delete]
+func clearSkippedSections(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	songID, ok := songIDParam(c)
+	if !ok {
+		return
+	}
+	userID := currentUserID(c)
+
+	exists, err := songRepo.Exists(ctx, userID, songID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to check if song exists: "+err.Error())
+		return
+	}
+	if !exists {
+		respondErrorCode(c, http.StatusNotFound, codeSongNotFound, "Song not found")
+		return
+	}
+
+	deletedCount, err := songRepo.ClearSkippedSections(ctx, userID, songID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to delete skipped sections: "+err.Error())
+		return
+	}
+
+	respond(c, http.StatusOK, "Skipped sections cleared successfully!", gin.H{"deleted_count": deletedCount})
+}
+
+// Consolidates a duplicate of a song, such as the same track released in another region,
+// into the song: the source's skipped sections and skip events move over, overlapping
+// sections are merged, and the source song is deleted
+//
+//	@Summary	Merge another song into a song
+//	@Tags		songs
+//	@Accept		json
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		id	path	string	true	"ID of the song to keep"
+//	@Param		request	body	mergeSongsRequest	true	"The song to merge in and delete"
+//	@Success	200	{object}	envelope{data=mergeSongsResponse}
+//	@Failure	400	{object}	errorResponse
+//	@Failure	404	{object}	errorResponse
+//	@Failure	415	{object}	errorResponse
+//	@Router		/v1/songs/{id}/merge [post]
+func mergeSongs(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	targetID, ok := songIDParam(c)
+	if !ok {
+		return
+	}
+
+	var request mergeSongsRequest
+
+	if !bindJSON(c, &request) {
+		return
+	}
+
+	sourceID, err := normalizeSpotifyTrackID(request.SourceSongID)
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidSongID, "Invalid source_song_id: "+err.Error())
+		return
+	}
+	if sourceID == targetID {
+		respondError(c, http.StatusBadRequest, "Invalid request: a song cannot be merged into itself")
+		return
+	}
+
+	created, err := songRepo.MergeSongs(ctx, currentUserID(c), targetID, sourceID)
+	if errors.Is(err, errSongNotFound) {
+		respondErrorCode(c, http.StatusNotFound, codeSongNotFound, "Song not found")
+		return
+	}
+	if errors.Is(err, errMergeSourceNotFound) {
+		respondErrorCode(c, http.StatusNotFound, codeSongNotFound, "Source song not found")
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to merge songs: "+err.Error())
+		return
+	}
+
+	respond(c, http.StatusOK, "Songs merged successfully!", gin.H{
+		"section_count":    len(created),
+		"skipped_sections": created})
+}
+
+// Validates the times of each section, and its bounds when the song duration is known
+func validateSectionInputs(sections []sectionInput, duration *int) error {
+	for i, section := range sections {
+		if err := validateSectionInput(section, duration); err != nil {
+			return fmt.Errorf("Invalid skipped section at index %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Validates a single section on its own, without looking at other sections
+func validateSectionInput(section sectionInput, duration *int) error {
+	if err := validateSectionTimes(section.StartTime, section.EndTime); err != nil {
+		return err
+	}
+	if duration != nil && section.EndTime > *duration {
+		return fmt.Errorf("end_time exceeds song duration of %d", *duration)
+	}
+	if section.Label != nil && utf8.RuneCountInString(*section.Label) > maxSectionLabelLength {
+		return fmt.Errorf("label exceeds %d characters", maxSectionLabelLength)
+	}
+	return nil
+}
+
+// Collects every problem addSkippedSections would reject the sections for, by index.
+// Sections that overlap each other are only an issue when merging is disabled,
+// since otherwise they would be merged before saving.
+func sectionIssues(sections []sectionInput, duration *int, existing []skippedSection, gap int) []sectionIssue {
+	issues := []sectionIssue{}
+	for i, section := range sections {
+		if err := validateSectionInput(section, duration); err != nil {
+			issues = append(issues, sectionIssue{Index: i, Message: err.Error()})
+			continue
+		}
+
+		for _, stored := range existing {
+			// An exact copy of a stored section is reported as already existing, not rejected
+			if section.StartTime == stored.StartTime && section.EndTime == stored.EndTime {
+				continue
+			}
+			if section.StartTime < stored.EndTime && stored.StartTime < section.EndTime {
+				issues = append(issues, sectionIssue{Index: i, Message: "overlaps stored skipped section " + stored.String()})
+			}
+		}
+
+		if gap >= 0 {
+			continue
+		}
+		for j, other := range sections[:i] {
+			// Repeated sections are dropped rather than rejected
+			if section.StartTime == other.StartTime && section.EndTime == other.EndTime {
+				continue
+			}
+			if section.StartTime < other.EndTime && other.StartTime < section.EndTime {
+				issues = append(issues, sectionIssue{Index: i, Message: fmt.Sprintf("overlaps skipped section at index %d", j)})
+			}
+		}
+	}
+	return issues
+}
+
+// Per-user storage limits, set by MAX_SONGS_PER_USER and MAX_SECTIONS_PER_USER
+var (
+	maxSongsPerUser    = 5000
+	maxSectionsPerUser = 50000
+)
+
+// Longest label a skipped section may carry
+const maxSectionLabelLength = 100
+
+// Default gap, in milliseconds, within which neighbouring sections are merged. Set by MERGE_GAP.
+var defaultMergeGap = 1000
+
+// Uses the gap from the request when given, otherwise the server default. A negative gap disables merging.
+func mergeGapOrDefault(gap *int) int {
+	if gap != nil {
+		return *gap
+	}
+	return defaultMergeGap
+}
+
+// Removes sections with the same start and end as an earlier one, keeping the first
+func dedupeSections(sections []sectionInput) []sectionInput {
+	unique := make([]sectionInput, 0, len(sections))
+	for _, section := range sections {
+		duplicate := slices.ContainsFunc(unique, func(kept sectionInput) bool {
+			return kept.StartTime == section.StartTime && kept.EndTime == section.EndTime
+		})
+		if !duplicate {
+			unique = append(unique, section)
+		}
+	}
+	return unique
+}
+
+// Coalesces sections that overlap or are separated by at most gap into single sections, sorted by start time.
+// A negative gap returns the sections unchanged.
+func mergeSections(sections []sectionInput, gap int) []sectionInput {
+	if gap < 0 || len(sections) < 2 {
+		return sections
+	}
+
+	sorted := slices.Clone(sections)
+	slices.SortFunc(sorted, func(a, b sectionInput) int {
+		return cmp.Compare(a.StartTime, b.StartTime)
+	})
+
+	merged := []sectionInput{sorted[0]}
+	for _, section := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if section.StartTime <= last.EndTime+gap {
+			last.EndTime = max(last.EndTime, section.EndTime)
+			// The merged section keeps the first label it was given
+			if last.Label == nil {
+				last.Label = section.Label
+			}
+			continue
+		}
+		merged = append(merged, section)
+	}
+	return merged
+}
+
+// Separates sections identical to stored ones, returning the sections still to insert
+// and the stored copies of the rest
+func splitExistingSections(sections []sectionInput, existing []skippedSection) ([]sectionInput, []skippedSection) {
+	alreadyExisted := []skippedSection{}
+	sections = slices.DeleteFunc(sections, func(section sectionInput) bool {
+		index := slices.IndexFunc(existing, func(stored skippedSection) bool {
+			return stored.StartTime == section.StartTime && stored.EndTime == section.EndTime
+		})
+		if index >= 0 {
+			alreadyExisted = append(alreadyExisted, existing[index])
+		}
+		return index >= 0
+	})
+	return sections, alreadyExisted
+}
+
+// Converts client sections into unsaved skipped sections
+func inputSections(inputs []sectionInput) []skippedSection {
+	sections := make([]skippedSection, len(inputs))
+	for i, input := range inputs {
+		sections[i] = skippedSection{StartTime: input.StartTime, EndTime: input.EndTime, Label: input.Label}
+	}
+	return sections
+}
+
+// Finds the enabled section playing at position and where the player should seek to get
+// past it. Sections that start right where the previous one ends are skipped together, so
+// the seek target is the end of the whole run.
+func sectionAt(sections []skippedSection, position int) (skippedSection, int, bool) {
+	sorted := slices.Clone(enabledSections(sections))
+	slices.SortFunc(sorted, func(a, b skippedSection) int {
+		return a.StartTime - b.StartTime
+	})
+
+	for i, section := range sorted {
+		if position < section.StartTime || position >= section.EndTime {
+			continue
+		}
+		seekTo := section.EndTime
+		for _, next := range sorted[i+1:] {
+			if next.StartTime > seekTo {
+				break
+			}
+			seekTo = max(seekTo, next.EndTime)
+		}
+		return section, seekTo, true
+	}
+	return skippedSection{}, 0, false
+}
+
+// Drops disabled sections, which clients only see when they ask for them
+func enabledSections(sections []skippedSection) []skippedSection {
+	return slices.DeleteFunc(sections, func(section skippedSection) bool {
+		return !section.Enabled
+	})
+}
+
+// Finds the first pair of overlapping sections once sorted by start time.
+// Sections that only touch (one ends where the next starts) do not overlap.
+func findOverlap(sections []skippedSection) (skippedSection, skippedSection, bool) {
+	sorted := slices.Clone(sections)
+	slices.SortFunc(sorted, func(a, b skippedSection) int {
+		return cmp.Compare(a.StartTime, b.StartTime)
+	})
+
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].StartTime < sorted[i-1].EndTime {
+			return sorted[i-1], sorted[i], true
+		}
+	}
+	return skippedSection{}, skippedSection{}, false
+}
+
+// Sums the time covered by the sections, counting overlapping stretches only once
+func totalSkippedTime(sections []skippedSection) int {
+	sorted := slices.Clone(sections)
+	slices.SortFunc(sorted, func(a, b skippedSection) int {
+		return cmp.Compare(a.StartTime, b.StartTime)
+	})
+
+	total := 0
+	coveredUntil := 0
+	for _, section := range sorted {
+		start := max(section.StartTime, coveredUntil)
+		if section.EndTime > start {
+			total += section.EndTime - start
+		}
+		coveredUntil = max(coveredUntil, section.EndTime)
+	}
+	return total
+}
+
+// Formats a section as "start-end", including its ID when it is already stored
+func (s skippedSection) String() string {
+	if s.ID != 0 {
+		return fmt.Sprintf("%d-%d (id %d)", s.StartTime, s.EndTime, s.ID)
+	}
+	return fmt.Sprintf("%d-%d", s.StartTime, s.EndTime)
+}
+
+// Checks that a skipped section has non-negative times and ends after it starts
+func validateSectionTimes(startTime, endTime int) error {
+	if startTime < 0 || endTime < 0 {
+		return errors.New("start_time and end_time must not be negative")
+	}
+	if endTime <= startTime {
+		return errors.New("end_time must be greater than start_time")
+	}
+	if endTime > maxTrackTime {
+		return fmt.Errorf("end_time must not exceed %d milliseconds", maxTrackTime)
+	}
+	return nil
+}
+
+// All times (song durations, section start and end) are milliseconds, as reported by
+// Spotify's player. Nothing longer than a day is a real track, so larger values are
+// almost certainly a unit mix-up.
+const maxTrackTime = 24 * 60 * 60 * 1000
+
+// Trims a title or artist and collapses runs of whitespace inside it to single spaces,
+// so the same song typed slightly differently is stored the same way
+func normalizeText(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// Checks an optional song duration is within (0, maxTrackTime]
+func validateDuration(duration *int) error {
+	if duration != nil && (*duration <= 0 || *duration > maxTrackTime) {
+		return fmt.Errorf("duration must be between 1 and %d milliseconds", maxTrackTime)
+	}
+	return nil
+}
+
+// Adds a new song to the database
+//
+//	@Summary	Add a song
+//	@Tags		songs
+//	@Accept		json
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		song	body	songRequest	true	"Song to add; song_id may be a track ID, spotify:track: URI or open.spotify.com URL, and a missing title, artist or duration is fetched from Spotify"
+//	@Param		upsert	query	bool	false	"Update title, artist and duration instead of failing when the song exists"
+//	@Success	200	{object}	envelope{data=addSongResponse}
+//	@Failure	400	{object}	errorResponse
+//	@Failure	403	{object}	errorResponse
+//	@Failure	409	{object}	errorResponse
+//	@Failure	415	{object}	errorResponse
+//	@Router		/v1/addSong [post]
+func addSong(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	var song songRequest
+
+	// Defines the structure of the json request to the song struct
+	if !bindJSON(c, &song) {
+		return
+	}
+
+	// Accept bare track IDs as well as Spotify URIs and URLs, storing only the ID
+	songID, err := normalizeSpotifyTrackID(song.SongID)
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidSongID, "Invalid song_id: "+err.Error())
+		return
+	}
+	song.SongID = songID
+
+	// Duration is optional but must be a plausible track length when given
+	if err := validateDuration(song.Duration); err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidDuration, "Invalid request: "+err.Error())
+		return
+	}
+
+	// The song being written doesn't count against the quota, so upserting an existing song is always allowed
+	songCount, err := songRepo.CountOtherSongs(ctx, currentUserID(c), song.SongID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to check song quota: "+err.Error())
+		return
+	}
+	if songCount >= maxSongsPerUser {
+		respondErrorCode(c, http.StatusForbidden, codeSongQuotaExceeded, fmt.Sprintf("Song quota exceeded: at most %d songs can be stored per user", maxSongsPerUser))
+		return
+	}
+
+	// Look up whatever the client left out; if Spotify can't help, the song is stored by its ID alone
+	song.Title, song.Artist = normalizeText(song.Title), normalizeText(song.Artist)
+	enrichSong(c, &song)
+
+	duplicateOf, ok := findDuplicateSong(c, ctx, song.SongID, song.Title, song.Artist)
+	if !ok {
+		return
+	}
+
+	// In upsert mode an existing song, even a deleted one, is updated and revived instead.
+	// Fields still missing after the Spotify lookup keep their stored values.
+	if c.Query("upsert") == "true" {
+		created, err := songRepo.Upsert(ctx, currentUserID(c), song)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to upsert song: "+err.Error())
+			return
+		}
+
+		if created {
+			respond(c, http.StatusOK, "Song added successfully!", addSongResponse{Status: "created", PossibleDuplicateOf: duplicateOf})
+		} else {
+			respond(c, http.StatusOK, "Song updated successfully!", addSongResponse{Status: "updated", PossibleDuplicateOf: duplicateOf})
+		}
+		return
+	}
+
+	// Insert song into the database
+	err = songRepo.Insert(ctx, currentUserID(c), song)
+
+	if errors.Is(err, errSongExists) {
+		respondErrorCode(c, http.StatusConflict, codeDuplicateSong, "Song already exists")
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to insert song: "+err.Error())
+		return
+	}
+
+	respond(c, http.StatusOK, "Song added successfully!", addSongResponse{Status: "created", PossibleDuplicateOf: duplicateOf})
+}
+
+const maxBulkSongs = 500
+
+// Upper bound on the skipped sections accepted in one request
+const maxSkippedSections = 1000
+
+// Adds skipped sections to many songs in one transaction, reporting the outcome for each
+// song. Songs whose sections are invalid, or that don't exist, are left out without
+// failing the others; with create_missing, missing songs are created by ID instead.
+//
+//	@Summary	Add skipped sections to many songs at once
+//	@Tags		sections
+//	@Accept		json
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		request	body	addSkippedSectionsBatchRequest	true	"Sections to add, in milliseconds, keyed by song ID"
+//	@Success	200	{object}	envelope{data=addSkippedSectionsBatchResponse}
+//	@Failure	400	{object}	errorResponse
+//	@Failure	403	{object}	errorResponse
+//	@Failure	413	{object}	errorResponse
+//	@Failure	415	{object}	errorResponse
+//	@Router		/v1/addSkippedSectionsBatch [post]
+func addSkippedSectionsBatch(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	var request addSkippedSectionsBatchRequest
+
+	// Songs are validated one by one below, so a bad song doesn't reject the whole batch
+	if !decodeJSON(c, &request) {
+		return
+	}
+	if len(request.Songs) == 0 {
+		respondError(c, http.StatusBadRequest, "Invalid request: no songs provided")
+		return
+	}
+	if len(request.Songs) > maxBulkSongs {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid request: at most %d songs can be sent at once", maxBulkSongs))
+		return
+	}
+	sectionCount := 0
+	for _, sections := range request.Songs {
+		sectionCount += len(sections)
+	}
+	if sectionCount > maxSkippedSections {
+		respondErrorCode(c, http.StatusRequestEntityTooLarge, codeTooManySections, fmt.Sprintf("At most %d skipped sections can be sent at once", maxSkippedSections))
+		return
+	}
+
+	// Handle songs in ID order so results are stable and concurrent batches lock rows in the same order.
+	// Songs rejected here keep their result; the rest are filled in by the repository.
+	results := []songSectionsResult{}
+	var songs []songSections
+	var queued []int
+	seen := map[string]bool{}
+	for _, key := range slices.Sorted(maps.Keys(request.Songs)) {
+		sections := request.Songs[key]
+		result := songSectionsResult{SongID: key, SkippedSections: []skippedSection{}, AlreadyExisted: []skippedSection{}}
+
+		songID, err := normalizeSpotifyTrackID(key)
+		if err != nil {
+			result.Status, result.Error = "invalid", "Invalid song ID: "+err.Error()
+			results = append(results, result)
+			continue
+		}
+		result.SongID = songID
+		if seen[songID] {
+			result.Status, result.Error = "invalid", "song is listed more than once"
+			results = append(results, result)
+			continue
+		}
+		seen[songID] = true
+
+		if fields := validateRequest(replaceSkippedSectionsRequest{SkippedSections: sections}); fields != nil {
+			result.Status, result.Error = "invalid", fieldErrorsMessage(fields)
+			results = append(results, result)
+			continue
+		}
+
+		songs = append(songs, songSections{SongID: songID, Sections: sections})
+		queued = append(queued, len(results))
+		results = append(results, result)
+	}
+
+	added, err := songRepo.AddSkippedSectionsBatch(ctx, currentUserID(c), songs, request.CreateMissing, mergeGapOrDefault(request.MergeGap))
+	if errors.Is(err, errSongQuotaExceeded) {
+		respondErrorCode(c, http.StatusForbidden, codeSongQuotaExceeded, fmt.Sprintf("Song quota exceeded: at most %d songs can be stored per user", maxSongsPerUser))
+		return
+	}
+	if errors.Is(err, errSectionQuotaExceeded) {
+		respondErrorCode(c, http.StatusForbidden, codeSectionQuotaExceeded, fmt.Sprintf("Skipped section quota exceeded: at most %d skipped sections can be stored per user", maxSectionsPerUser))
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to add skipped sections, none saved: "+err.Error())
+		return
+	}
+	for i, index := range queued {
+		results[index] = added[i]
+	}
+
+	respond(c, http.StatusOK, "Skipped sections added successfully!", gin.H{"results": results})
+}
+
+// Adds a batch of songs in one transaction, reporting the outcome of each item
+//
+//	@Summary	Add up to 500 songs at once
+//	@Tags		songs
+//	@Accept		json
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		songs	body	[]songRequest	true	"Songs to add"
+//	@Success	200	{object}	envelope{data=addSongsResponse}
+//	@Failure	400	{object}	errorResponse
+//	@Failure	403	{object}	errorResponse
+//	@Failure	415	{object}	errorResponse
+//	@Router		/v1/addSongs [post]
+func addSongs(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	var songs []songRequest
+
+	// Songs are validated one by one below, so a bad song doesn't reject the whole batch
+	if !decodeJSON(c, &songs) {
+		return
+	}
+	if len(songs) == 0 {
+		respondError(c, http.StatusBadRequest, "Invalid request: no songs provided")
+		return
+	}
+	if len(songs) > maxBulkSongs {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid request: at most %d songs can be added at once", maxBulkSongs))
+		return
+	}
+
+	results := make([]songResult, len(songs))
+
+	// Validate each song, queueing only the valid ones for insertion
+	var valid []songRequest
+	var queued []int
+	for i, song := range songs {
+		results[i] = songResult{Index: i, SongID: song.SongID}
+
+		if fields := validateRequest(song); fields != nil {
+			results[i].Status = "invalid"
+			results[i].Error = fieldErrorsMessage(fields)
+			continue
+		}
+		// Unlike addSong, batches aren't looked up on Spotify
+		song.Title, song.Artist = normalizeText(song.Title), normalizeText(song.Artist)
+		if song.Title == "" || song.Artist == "" {
+			results[i].Status = "invalid"
+			results[i].Error = "title and artist are required"
+			continue
+		}
+		songID, err := normalizeSpotifyTrackID(song.SongID)
+		if err != nil {
+			results[i].Status = "invalid"
+			results[i].Error = "invalid song_id: " + err.Error()
+			continue
+		}
+		if err := validateDuration(song.Duration); err != nil {
+			results[i].Status = "invalid"
+			results[i].Error = err.Error()
+			continue
+		}
+
+		results[i].SongID = songID
+		song.SongID = songID
+		valid = append(valid, song)
+		queued = append(queued, i)
+	}
+
+	inserted, err := songRepo.AddSongs(ctx, currentUserID(c), valid)
+	if errors.Is(err, errSongQuotaExceeded) {
+		respondErrorCode(c, http.StatusForbidden, codeSongQuotaExceeded, fmt.Sprintf("Song quota exceeded: at most %d songs can be stored per user, no songs were added", maxSongsPerUser))
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to add songs: "+err.Error())
+		return
+	}
+	for i, index := range queued {
+		if inserted[i] {
+			results[index].Status = "created"
+		} else {
+			results[index].Status = "duplicate"
+			results[index].Error = "song already exists"
+		}
+	}
+
+	created := 0
+	for _, result := range results {
+		if result.Status == "created" {
+			created++
+		}
+	}
+
+	respond(c, http.StatusOK, fmt.Sprintf("Added %d of %d songs successfully!", created, len(songs)), gin.H{"results": results})
+}
+
+// Spotify track IDs are 22-character base62 strings
+var spotifyTrackIDPattern = regexp.MustCompile(`^[A-Za-z0-9]{22}$`)
+
+// Extracts the bare track ID from a track ID, a spotify:track: URI, or an open.spotify.com track URL
+func normalizeSpotifyTrackID(input string) (string, error) {
+	id := strings.TrimSpace(input)
+
+	if rest, found := strings.CutPrefix(id, "spotify:track:"); found {
+		id = rest
+	} else if strings.HasPrefix(id, "http://") || strings.HasPrefix(id, "https://") {
+		parsed, err := url.Parse(id)
+		if err != nil || parsed.Host != "open.spotify.com" {
+			return "", errors.New("expected an open.spotify.com track URL")
+		}
+		// Paths look like /track/ID, optionally with a locale prefix such as /intl-de/track/ID
+		segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+		if len(segments) < 2 || segments[len(segments)-2] != "track" {
+			return "", errors.New("expected an open.spotify.com track URL")
+		}
+		id = segments[len(segments)-1]
+	}
+
+	if !spotifyTrackIDPattern.MatchString(id) {
+		return "", errors.New("must be a 22-character Spotify track ID")
+	}
+	return id, nil
+}
+
+// Normalizes a song ID sent in a request body like songIDParam does for the path.
+// Answers 400 and returns false when it isn't a recognizable track.
+func songIDBody(c *gin.Context, id string) (string, bool) {
+	songID, err := normalizeSpotifyTrackID(id)
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidSongID, "Invalid song_id: "+err.Error())
+		return "", false
+	}
+	return songID, true
+}
+
+// Reads the song ID from the path, accepting the same forms as normalizeSpotifyTrackID.
+// Answers 400 and returns false when it isn't a recognizable track.
+func songIDParam(c *gin.Context) (string, bool) {
+	songID, err := normalizeSpotifyTrackID(c.Param("id"))
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidSongID, "Invalid song ID: "+err.Error())
+		return "", false
+	}
+	return songID, true
+}
+
+// Reports whether err is a Postgres unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// Retrieves one song from the database
+//
+//	@Summary	Get a song
+//	@Tags		songs
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		id	path	string	true	"Song ID, spotify:track: URI or percent-encoded open.spotify.com URL"
+//	@Param		If-None-Match	header	string	false	"ETag from a previous response"
+//	@Success	200	{object}	envelope{data=songResponse}
+//	@Failure	304	"Not modified"
+//	@Failure	400	{object}	errorResponse
+//	@Failure	404	{object}	errorResponse
+//	@Router		/v1/getSong/{id} [get]
+func getSong(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	songID, ok := songIDParam(c)
+	if !ok {
+		return
+	}
+
+	song, err := songRepo.GetByID(ctx, currentUserID(c), songID)
+	if errors.Is(err, errSongNotFound) {
+		respondErrorCode(c, http.StatusNotFound, codeSongNotFound, "Song not found")
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve song: "+err.Error())
+		return
+	}
+
+	// Lets clients make later updates conditional with If-Unmodified-Since
+	c.Header("Last-Modified", song.UpdatedAt.UTC().Format(http.TimeFormat))
+	respondWithETag(c, envelope{Message: "Song retrieved successfully!", Data: gin.H{"song": song}})
+}
+
+// Retrieves a song with its skipped sections
+//
+//	@Summary	Get a song with its skipped sections
+//	@Tags		songs
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		id	path	string	true	"Song ID, spotify:track: URI or percent-encoded open.spotify.com URL"
+//	@Param		include_disabled	query	bool	false	"Also return disabled skipped sections"
+//	@Param		If-None-Match	header	string	false	"ETag from a previous response"
+//	@Success	200	{object}	envelope{data=songDetailsResponse}
+//	@Failure	304	"Not modified"
+//	@Failure	400	{object}	errorResponse
+//	@Failure	404	{object}	errorResponse
+//	@Router		/v1/getSongDetails/{id} [get]
+func getSongDetails(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	songID, ok := songIDParam(c)
+	if !ok {
+		return
+	}
+	song, err := songRepo.GetDetails(ctx, currentUserID(c), songID)
+	if errors.Is(err, errSongNotFound) {
+		respondErrorCode(c, http.StatusNotFound, codeSongNotFound, "Song not found")
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve song: "+err.Error())
+		return
+	}
+
+	if c.Query("include_disabled") != "true" {
+		song.SkippedSections = enabledSections(song.SkippedSections)
+	}
+	song.TotalSkippedMs = totalSkippedTime(song.SkippedSections)
+	song.TotalSkippedSeconds = song.TotalSkippedMs / 1000
+
+	skipFetches.Add(1)
+	respondWithETag(c, envelope{Message: "Song retrieved successfully!", Data: gin.H{"song": song}})
+}
+
+// Retrieves several songs with their skipped sections in two queries. IDs that
+// don't match a song are left out of the result instead of failing the batch.
+//
+//	@Summary	Get several songs with their skipped sections
+//	@Tags		songs
+//	@Accept		json
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		request	body	songDetailsBatchRequest	true	"IDs of the songs to retrieve"
+//	@Param		include_disabled	query	bool	false	"Also return disabled skipped sections"
+//	@Success	200	{object}	envelope{data=songDetailsBatchResponse}
+//	@Failure	400	{object}	errorResponse
+//	@Failure	415	{object}	errorResponse
+//	@Router		/v1/getSongDetailsBatch [post]
+func getSongDetailsBatch(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	var request songDetailsBatchRequest
+
+	if !bindJSON(c, &request) {
+		return
+	}
+	if len(request.SongIDs) > maxBulkSongs {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid request: at most %d songs can be requested at once", maxBulkSongs))
+		return
+	}
+	for i, id := range request.SongIDs {
+		songID, err := normalizeSpotifyTrackID(id)
+		if err != nil {
+			respondErrorCode(c, http.StatusBadRequest, codeInvalidSongID, fmt.Sprintf("Invalid song ID at index %d: %v", i, err))
+			return
+		}
+		request.SongIDs[i] = songID
+	}
+
+	songs, err := songRepo.GetDetailsBatch(ctx, currentUserID(c), request.SongIDs, c.Query("include_disabled") == "true")
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve songs: "+err.Error())
+		return
+	}
+
+	for _, song := range songs {
+		song.TotalSkippedMs = totalSkippedTime(song.SkippedSections)
+		song.TotalSkippedSeconds = song.TotalSkippedMs / 1000
+	}
+
+	skipFetches.Add(1)
+	respond(c, http.StatusOK, "Songs retrieved successfully!", gin.H{"songs": songs})
+}
+
+// Sends body as a 200 JSON response tagged with an ETag derived from its content,
+// or a bodyless 304 when the client's If-None-Match already has that version
+func respondWithETag(c *gin.Context, body any) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to encode response: "+err.Error())
+		return
+	}
+
+	sum := sha256.Sum256(payload)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	c.Header("ETag", etag)
+
+	for _, candidate := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", payload)
+}
+
+// Columns getSongs can sort by, keyed by the name clients use. Only these ever reach the
+// ORDER BY clause, so the sort parameter can't inject SQL.
+var songSortColumns = map[string]string{
+	"title":  "title",
+	"artist": "artist",
+	"recent": "created_at",
+}
+
+// An ORDER BY for listing songs. Ties are broken by song ID so pages are stable.
+type songOrder struct {
+	column     string
+	descending bool
+}
+
+func (o songOrder) String() string {
+	if o.descending {
+		return o.column + " DESC, song_id"
+	}
+	return o.column + ", song_id"
+}
+
+// Parses a sort parameter such as title or artist_desc. recent lists the newest songs
+// first, so recent_desc lists the oldest first.
+func parseSongSort(sort string) (songOrder, bool) {
+	name, descending := strings.CutSuffix(sort, "_desc")
+	column, ok := songSortColumns[name]
+	if !ok {
+		return songOrder{}, false
+	}
+	if name == "recent" {
+		descending = !descending
+	}
+	return songOrder{column: column, descending: descending}, true
+}
+
+// Lists the IDs of all the user's songs, for clients that only need to know which
+// tracks have skip data before fetching details. The list is bounded by the song quota,
+// so it is returned whole.
+//
+//	@Summary	List the IDs of the user's songs
+//	@Tags		songs
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		has_sections	query	bool	false	"Only songs with at least one enabled skipped section"
+//	@Success	200	{object}	envelope{data=songIDsResponse}
+//	@Router		/v1/songIds [get]
+func getSongIDs(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	songIDs, err := songRepo.ListIDs(ctx, currentUserID(c), c.Query("has_sections") == "true")
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve song IDs: "+err.Error())
+		return
+	}
+
+	respond(c, http.StatusOK, "Song IDs retrieved successfully!", gin.H{"song_ids": songIDs})
+}
+
+// Tells a player at position whether it is inside a skipped section of the song, and
+// where to seek to. Answers 204 when the position is not in any enabled section.
+//
+//	@Summary	Get the skipped section at a playback position
+//	@Tags		sections
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		id	path	string	true	"Song ID"
+//	@Param		position	query	int	true	"Playback position in milliseconds"
+//	@Success	200	{object}	envelope{data=skipAtResponse}
+//	@Success	204
+//	@Failure	400	{object}	errorResponse
+//	@Failure	404	{object}	errorResponse
+//	@Router		/v1/songs/{id}/skipAt [get]
+func getSkipAt(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	songID, ok := songIDParam(c)
+	if !ok {
+		return
+	}
+	position, err := strconv.Atoi(c.Query("position"))
+	if err != nil || position < 0 {
+		respondError(c, http.StatusBadRequest, "position must be a non-negative number of milliseconds")
+		return
+	}
+	userID := currentUserID(c)
+
+	exists, err := songRepo.Exists(ctx, userID, songID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to check if song exists: "+err.Error())
+		return
+	}
+	if !exists {
+		respondErrorCode(c, http.StatusNotFound, codeSongNotFound, "Song not found")
+		return
+	}
+
+	sections, err := songRepo.SkippedSections(ctx, userID, songID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve skipped sections: "+err.Error())
+		return
+	}
+
+	section, seekTo, found := sectionAt(sections, position)
+	if !found {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	skipFetches.Add(1)
+	respond(c, http.StatusOK, "Skipped section found!", gin.H{"skipped_section": section, "seek_to": seekTo})
+}
+
+// Retrieves all songs from the database
+//
+//	@Summary	List songs
+//	@Tags		songs
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		limit	query	int	false	"Page size (default 50, max 200)"
+//	@Param		offset	query	int	false	"Number of songs to skip; cannot be combined with cursor"
+//	@Param		cursor	query	string	false	"next_cursor of the previous page, for keyset pagination"
+//	@Param		sort	query	string	false	"Sort order; recent lists the newest first and _desc reverses any order (default title)" Enums(title, title_desc, artist, artist_desc, recent, recent_desc)
+//	@Param		artist	query	string	false	"Only songs whose artist contains this text, case-insensitively"
+//	@Success	200	{object}	envelope{data=songSummaryListResponse}
+//	@Failure	400	{object}	errorResponse
+//	@Router		/v1/getSongs [get]
+func getSongs(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidPagination, err.Error())
+		return
+	}
+
+	cursor, err := parseCursor(c)
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidCursor, err.Error())
+		return
+	}
+	if cursor != nil && offset != 0 {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidCursor, "cursor and offset cannot be combined")
+		return
+	}
+
+	userID := currentUserID(c)
+
+	sort := c.DefaultQuery("sort", "title")
+	order, ok := parseSongSort(sort)
+	if !ok {
+		respondError(c, http.StatusBadRequest, "sort must be one of title, artist or recent, optionally suffixed with _desc")
+		return
+	}
+	recent := order.column == "created_at"
+
+	if cursor != nil && (cursor.Sort != sort || (recent && cursor.CreatedAt == nil)) {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidCursor, "cursor was not issued for sort="+sort)
+		return
+	}
+
+	// The artist filter is a case-insensitive partial match, so it also matches exact names
+	songs, totalCount, err := songRepo.ListSongs(ctx, userID, songListOptions{
+		Limit:  limit,
+		Offset: offset,
+		Order:  order,
+		Artist: strings.TrimSpace(c.Query("artist")),
+		After:  cursor,
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve songs: "+err.Error())
+		return
+	}
+
+	// A full page may be followed by more songs
+	var nextCursor *string
+	if limit > 0 && len(songs) == limit {
+		last := songs[len(songs)-1]
+		next := pageCursor{SongID: last.SongID, Sort: sort}
+		switch order.column {
+		case "title":
+			next.Value = last.Title
+		case "artist":
+			next.Value = last.Artist
+		case "created_at":
+			next.CreatedAt = &last.CreatedAt
+		}
+		nextCursor = encodeCursor(next)
+	}
+
+	// Pages reached by cursor only know the way forward
+	if cursor == nil {
+		setPageLinks(c, limit, offset, totalCount)
+	} else if nextCursor != nil {
+		c.Header("Link", pageLink(c, "next", url.Values{"cursor": {*nextCursor}}))
+	}
+
+	respond(c, http.StatusOK, "Songs retrieved successfully!", gin.H{
+		"songs":       songs,
+		"total_count": totalCount,
+		"limit":       limit,
+		"offset":      offset,
+		"next_cursor": nextCursor})
+}
+
+const maxSearchQueryLength = 100
+
+// Searches the user's songs with a case-insensitive partial match on title or artist
+//
+//	@Summary	Search songs by title or artist
+//	@Tags		songs
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		q	query	string	true	"Case-insensitive text to match (max 100 characters)"
+//	@Param		limit	query	int	false	"Page size (default 50, max 200)"
+//	@Param		offset	query	int	false	"Number of songs to skip"
+//	@Success	200	{object}	envelope{data=songListResponse}
+//	@Failure	400	{object}	errorResponse
+//	@Router		/v1/searchSongs [get]
+func searchSongs(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		respondError(c, http.StatusBadRequest, "Search query must not be empty")
+		return
+	}
+	if utf8.RuneCountInString(query) > maxSearchQueryLength {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("Search query must be at most %d characters", maxSearchQueryLength))
+		return
+	}
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidPagination, err.Error())
+		return
+	}
+
+	// The query is matched against "artist - title", so it may span the two
+	songs, totalCount, err := songRepo.Search(ctx, currentUserID(c), normalizeText(query), limit, offset)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to search songs: "+err.Error())
+		return
+	}
+
+	setPageLinks(c, limit, offset, totalCount)
+	respond(c, http.StatusOK, "Songs retrieved successfully!", gin.H{
+		"songs":       songs,
+		"total_count": totalCount,
+		"limit":       limit,
+		"offset":      offset})
+}
+
+// Returns the user's skipped sections grouped by song ID. With updated_since (RFC 3339),
+// only songs whose sections changed after that time are included, each with its full
+// current list, so a song that was cleared or deleted comes back with an empty array.
+//
+//	@Summary	Get skipped sections for all songs, keyed by song ID
+//	@Tags		sections
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		updated_since	query	string	false	"RFC 3339 time; only songs changed after it are returned"
+//	@Param		limit	query	int	false	"Songs per page (default 50, max 200); pages the map by song ID when given"
+//	@Param		offset	query	int	false	"Number of songs to skip; cannot be combined with cursor"
+//	@Param		cursor	query	string	false	"next_cursor of the previous page, for keyset pagination"
+//	@Param		include_disabled	query	bool	false	"Also return disabled skipped sections"
+//	@Success	200	{object}	envelope{data=skipMapResponse}
+//	@Failure	400	{object}	errorResponse
+//	@Router		/v1/skipMap [get]
+func getSkipMap(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	var updatedSince *time.Time
+	if value := c.Query("updated_since"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "updated_since must be an RFC 3339 timestamp")
+			return
+		}
+		updatedSince = &parsed
+	}
+
+	// The map is only paged when the client asks for it, so existing clients keep getting all of it
+	paged := c.Query("limit") != "" || c.Query("offset") != "" || c.Query("cursor") != ""
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidPagination, err.Error())
+		return
+	}
+	cursor, err := parseCursor(c)
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidCursor, err.Error())
+		return
+	}
+	if cursor != nil && offset != 0 {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidCursor, "cursor and offset cannot be combined")
+		return
+	}
+
+	options := skipMapOptions{
+		UpdatedSince:    updatedSince,
+		Paged:           paged,
+		Limit:           limit,
+		Offset:          offset,
+		IncludeDisabled: c.Query("include_disabled") == "true",
+	}
+	if cursor != nil {
+		options.After = cursor.SongID
+	}
+
+	skipMap, serverTime, err := songRepo.SkipMap(ctx, currentUserID(c), options)
 	if err != nil {
-		log.Fatal("error: Error loading .env file: ", err)
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve skip map: "+err.Error())
+		return
 	}
+
+	// A full page may be followed by more songs, continuing after its last song ID
+	var nextCursor *string
+	if paged && limit > 0 && len(skipMap) == limit {
+		nextCursor = encodeCursor(pageCursor{SongID: slices.Max(slices.Collect(maps.Keys(skipMap)))})
+	}
+
+	skipFetches.Add(1)
+	respond(c, http.StatusOK, "Skip map retrieved successfully!", gin.H{
+		"skip_map":    skipMap,
+		"server_time": serverTime,
+		"next_cursor": nextCursor})
 }
 
-func main() {
-	r := gin.Default()
+const (
+	defaultMostSkippedLimit = 10
+	maxMostSkippedLimit     = 100
+)
 
-	// Connect to the database
-	dbConnection()
+// Ranks songs by total skipped time, summed over every user's sections. Only IDs and
+// totals are shared across users; titles and artists are the caller's own.
+//
+//	@Summary	List the most skipped songs
+//	@Tags		songs
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		limit	query		int	false	"Number of songs (default 10, max 100)"
+//	@Success	200		{object}	envelope{data=mostSkippedResponse}
+//	@Failure	400		{object}	errorResponse
+//	@Router		/v1/songs/mostSkipped [get]
+func getMostSkippedSongs(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
 
-	// Test route
-	r.GET("/ping", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"message": "Pong!"})
-	})
+	limit := defaultMostSkippedLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			respondError(c, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(parsed, maxMostSkippedLimit)
+	}
+
+	songs, err := songRepo.MostSkipped(ctx, currentUserID(c), limit)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve most skipped songs: "+err.Error())
+		return
+	}
 
-	// Add a new song
-	r.POST("/addSong", addSong)
+	respond(c, http.StatusOK, "Most skipped songs retrieved successfully!", gin.H{"songs": songs})
+}
 
-	// Add skipped sections to a song
-	r.POST("/addSkippedSections", addSkippedSections)
+const (
+	defaultSectionStatsLimit = 5
+	maxSectionStatsLimit     = 50
+)
 
-	// Get song by ID
-	r.GET("/getSong/:id", getSong)
+// Summarizes the lengths of the user's skipped sections, with the longest and shortest ones
+//
+//	@Summary	Get skipped section statistics
+//	@Tags		sections
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		limit	query		int	false	"Number of longest and shortest sections (default 5, max 50)"
+//	@Success	200		{object}	envelope{data=sectionStatsResponse}
+//	@Failure	400		{object}	errorResponse
+//	@Router		/v1/skippedSections/stats [get]
+func getSectionStats(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
 
-	// Get song with skipped sections by ID
-	r.GET("/getSongDetails/:id", getSongDetails)
+	limit := defaultSectionStatsLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			respondError(c, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(parsed, maxSectionStatsLimit)
+	}
 
-	// Get all songs
-	r.GET("/getSongs", getSongs)
+	stats, err := songRepo.SectionStats(ctx, currentUserID(c), limit)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve section stats: "+err.Error())
+		return
+	}
 
-	// Update a song by ID
-	r.PUT("/updateSong/:id", updateSong)
+	respond(c, http.StatusOK, "Section stats retrieved successfully!", stats)
+}
 
-	// Delete a song by ID
-	r.DELETE("/deleteSong/:id", deleteSong)
+// Binds the JSON body into obj and checks its binding tags. Answers 415 unless the body
+// is declared as JSON, 413 when the body limit was hit and 400 for anything else, listing
+// every failed field when the body is well-formed but invalid.
+func bindJSON(c *gin.Context, obj any) bool {
+	if !decodeJSON(c, obj) {
+		return false
+	}
 
-	// Start the server on port 8080
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	if fields := validateRequest(obj); fields != nil {
+		respondValidationError(c, fields)
+		return false
+	}
+	return true
+}
+
+// Like bindJSON, but leaves validation to the caller; for batches that report invalid items one by one
+func decodeJSON(c *gin.Context, obj any) bool {
+	if c.ContentType() != binding.MIMEJSON {
+		respondError(c, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return false
+	}
+
+	err := json.NewDecoder(c.Request.Body).Decode(obj)
+	if err == nil {
+		return true
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit))
+		return false
 	}
-	fmt.Println("Server running on port", port)
-	r.Run(":" + port)
+
+	respondErrorCode(c, http.StatusBadRequest, codeInvalidBody, "Invalid request: "+err.Error())
+	return false
+}
+
+// Picks the gin mode: GIN_MODE when set, otherwise debug when APP_ENV is
+// "development" and release everywhere else
+func ginMode() string {
+	if mode := os.Getenv("GIN_MODE"); mode != "" {
+		return mode
+	}
+	if os.Getenv("APP_ENV") == "development" {
+		return gin.DebugMode
+	}
+	return gin.ReleaseMode
 }
 
-func dbConnection() {
-	databaseUser := os.Getenv("DBUSER")
-	databasePassword := os.Getenv("DBPASSWORD")
-	databaseName := os.Getenv("DBNAME")
-	databaseHost := os.Getenv("DBHOST")
-	databasePort := os.Getenv("DBPORT")
+// Lists songs of every user that have no skipped sections, to find incomplete entries
+//
+//	@Summary	List songs without skipped sections (admin)
+//	@Tags		admin
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		limit	query	int	false	"Page size (default 50, max 200)"
+//	@Param		offset	query	int	false	"Number of songs to skip"
+//	@Success	200	{object}	envelope{data=adminSongListResponse}
+//	@Failure	400	{object}	errorResponse
+//	@Failure	403	{object}	errorResponse
+//	@Router		/v1/admin/songsWithoutSkips [get]
+func getSongsWithoutSkips(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidPagination, err.Error())
+		return
+	}
 
-	databaseURL := fmt.Sprintf("postgresql://%s:%s@%s:%s/%s", databaseUser, databasePassword, databaseHost, databasePort, databaseName)
-	conn, err := pgx.Connect(context.Background(), databaseURL)
+	songs, totalCount, err := songRepo.ListSongsWithoutSkips(ctx, limit, offset)
 	if err != nil {
-		log.Fatalf("error: Unable to connect to database: %v: ", err)
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve songs: "+err.Error())
+		return
 	}
-	db = conn
-	fmt.Println("Connected to database successfully")
+
+	setPageLinks(c, limit, offset, totalCount)
+	respond(c, http.StatusOK, "Songs retrieved successfully!", gin.H{
+		"songs":       songs,
+		"total_count": totalCount,
+		"limit":       limit,
+		"offset":      offset})
 }
 
-// Add skipped sections to a song
-func addSkippedSections(c *gin.Context) {
-	var request struct {
-		SongID          string `json:"song_id"`
-		SkippedSections []struct {
-			ID        int `json:"id"`
-			StartTime int `json:"start_time"`
-			EndTime   int `json:"end_time"`
-		} `json:"skipped_sections"`
+// Records that the player skipped a section of a song, for analytics
+//
+//	@Summary	Record a skip event
+//	@Tags		events
+//	@Accept		json
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		request	body	skipEventRequest	true	"The skip; skipped_at defaults to now"
+//	@Success	200	{object}	envelope{data=skipEventResponse}
+//	@Failure	400	{object}	errorResponse
+//	@Failure	404	{object}	errorResponse
+//	@Failure	415	{object}	errorResponse
+//	@Router		/v1/skipEvents [post]
+func addSkipEvent(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	var request skipEventRequest
+
+	if !bindJSON(c, &request) {
+		return
 	}
 
-	// Bind JSON request to struct
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+	songID, ok := songIDBody(c, request.SongID)
+	if !ok {
 		return
 	}
+	request.SongID = songID
+
+	userID := currentUserID(c)
 
-	// Check if the song exists before inserting skipped sections
-	var exists bool
-	err := db.QueryRow(context.Background(), "SELECT EXISTS (SELECT 1 FROM songs WHERE song_id = $1)", request.SongID).Scan(&exists)
+	exists, err := songRepo.Exists(ctx, userID, request.SongID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check if song exists: " + err.Error()})
+		respondError(c, http.StatusInternalServerError, "Failed to check if song exists: "+err.Error())
 		return
 	}
 	if !exists {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Song not found"})
+		respondErrorCode(c, http.StatusNotFound, codeSongNotFound, "Song not found")
 		return
 	}
 
-	// Insert each skipped section into the database
-	for _, section := range request.SkippedSections {
-		_, err := db.Exec(context.Background(),
-			"INSERT INTO skipped_sections (song_id, start_time, end_time) VALUES ($1, $2, $3)",
-			request.SongID, section.StartTime, section.EndTime)
-
+	// The section is optional, but must belong to the song when given
+	if request.SectionID != nil {
+		sectionExists, err := songRepo.SectionExists(ctx, userID, request.SongID, *request.SectionID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert skipped section: " + err.Error()})
+			respondError(c, http.StatusInternalServerError, "Failed to check if skipped section exists: "+err.Error())
+			return
+		}
+		if !sectionExists {
+			respondErrorCode(c, http.StatusNotFound, codeSectionNotFound, "Skipped section not found")
 			return
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Skipped sections added successfully!"})
+	event, err := songRepo.AddSkipEvent(ctx, userID, request)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to record skip event: "+err.Error())
+		return
+	}
+
+	respond(c, http.StatusOK, "Skip event recorded successfully!", gin.H{"skip_event": event})
 }
 
-// Adds a new song to the database
-func addSong(c *gin.Context) {
-	var song struct {
-		SongID string `json:"song_id"`
-		Title  string `json:"title"`
-		Artist string `json:"artist"`
+// Retrieves the skip events recorded for one of the user's songs, most recent first
+//
+//	@Summary	List skip events of a song
+//	@Tags		events
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		id	path	string	true	"Song ID"
+//	@Param		limit	query	int	false	"Page size (default 50, max 200)"
+//	@Param		offset	query	int	false	"Number of events to skip"
+//	@Success	200	{object}	envelope{data=skipEventListResponse}
+//	@Failure	400	{object}	errorResponse
+//	@Failure	404	{object}	errorResponse
+//	@Router		/v1/songs/{id}/skipEvents [get]
+func getSkipEvents(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidPagination, err.Error())
+		return
 	}
 
-	// Defines the structure of the json request to the song struct
-	if err := c.ShouldBindJSON(&song); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "error: Invalid request: " + err.Error()})
+	songID, ok := songIDParam(c)
+	if !ok {
 		return
 	}
+	userID := currentUserID(c)
 
-	// Insert song into the database
-	_, err := db.Exec(context.Background(),
-		"INSERT INTO songs (song_id, title, artist) VALUES ($1, $2, $3)",
-		song.SongID, song.Title, song.Artist)
+	exists, err := songRepo.Exists(ctx, userID, songID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to check if song exists: "+err.Error())
+		return
+	}
+	if !exists {
+		respondErrorCode(c, http.StatusNotFound, codeSongNotFound, "Song not found")
+		return
+	}
 
+	events, err := songRepo.ListSkipEvents(ctx, userID, songID, limit, offset)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "error: Failed to insert song: " + err.Error()})
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve skip events: "+err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Song added successfully!"})
+	respond(c, http.StatusOK, "Skip events retrieved successfully!", gin.H{
+		"skip_events": events,
+		"limit":       limit,
+		"offset":      offset})
 }
 
-// Retrieves one song from the database
-func getSong(c *gin.Context) {
-	songID := c.Param("id")
-	if songID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "error: Invalid song ID"})
+// Escapes LIKE wildcards so user input is matched literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+// Reads the limit and offset query parameters, applying the default and max page size
+func parsePagination(c *gin.Context) (int, int, error) {
+	limit := defaultPageLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return 0, 0, errors.New("limit must be a non-negative integer")
+		}
+		limit = min(parsed, maxPageLimit)
+	}
+
+	offset := 0
+	if value := c.Query("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return 0, 0, errors.New("offset must be a non-negative integer")
+		}
+		offset = parsed
+	}
+
+	return limit, offset, nil
+}
+
+// Sets a Link header pointing at the first, previous, next and last pages of an offset-paginated
+// listing, for clients that navigate by RFC 8288 links rather than the body's paging fields
+func setPageLinks(c *gin.Context, limit, offset, totalCount int) {
+	if limit <= 0 {
 		return
 	}
 
-	var song struct {
-		SongID string `json:"song_id"`
-		Title  string `json:"title"`
-		Artist string `json:"artist"`
+	lastOffset := 0
+	if totalCount > 0 {
+		lastOffset = (totalCount - 1) / limit * limit
+	}
+
+	links := []string{pageLink(c, "first", url.Values{"offset": {"0"}})}
+	if offset > 0 {
+		links = append(links, pageLink(c, "prev", url.Values{"offset": {strconv.Itoa(max(offset-limit, 0))}}))
+	}
+	if offset+limit < totalCount {
+		links = append(links, pageLink(c, "next", url.Values{"offset": {strconv.Itoa(offset + limit)}}))
+	}
+	links = append(links, pageLink(c, "last", url.Values{"offset": {strconv.Itoa(lastOffset)}}))
+
+	c.Header("Link", strings.Join(links, ", "))
+}
+
+// Formats one Link header entry for the current request with the given query parameters
+// replaced. The limit is kept and any cursor dropped unless params set one.
+func pageLink(c *gin.Context, rel string, params url.Values) string {
+	query := c.Request.URL.Query()
+	query.Del("cursor")
+	query.Del("offset")
+	for name, values := range params {
+		query[name] = values
 	}
+	target := url.URL{Path: c.Request.URL.Path, RawQuery: query.Encode()}
+	return fmt.Sprintf("<%s>; rel=%q", target.String(), rel)
+}
 
-	err := db.QueryRow(context.Background(), "SELECT song_id, title, artist FROM songs WHERE song_id = $1", songID).
-		Scan(&song.SongID, &song.Title, &song.Artist)
+// Reads the optional cursor query parameter, returning nil when there is none
+func parseCursor(c *gin.Context) (*pageCursor, error) {
+	value := c.Query("cursor")
+	if value == "" {
+		return nil, nil
+	}
 
+	payload, err := base64.RawURLEncoding.DecodeString(value)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "error: Failed to retrieve song: " + err.Error()})
-		return
+		return nil, errors.New("cursor is invalid")
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Song retrieved successfully!", "song": song})
+	var cursor pageCursor
+	if err := json.Unmarshal(payload, &cursor); err != nil || cursor.SongID == "" {
+		return nil, errors.New("cursor is invalid")
+	}
+	return &cursor, nil
 }
 
-// Retrieves a song with its skipped sections
-func getSongDetails(c *gin.Context) {
-	songID := c.Param("id")
+// Encodes a page position as the opaque token returned in next_cursor
+func encodeCursor(cursor pageCursor) *string {
+	payload, _ := json.Marshal(cursor)
+	token := base64.RawURLEncoding.EncodeToString(payload)
+	return &token
+}
+
+// Delete a song by ID
+//
+//	@Summary	Delete a song
+//	@Tags		songs
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		id	path	string	true	"Song ID"
+//	@Param		hard	query	bool	false	"Permanently delete the song and its sections (admins only)"
+//	@Success	200	{object}	envelope
+//	@Failure	400	{object}	errorResponse
+//	@Failure	403	{object}	errorResponse
+//	@Failure	404	{object}	errorResponse
+//	@Router		/v1/deleteSong/{id} [delete]
+func deleteSong(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
 
-	var song struct {
-		SongID          string `json:"song_id"`
-		Title           string `json:"title"`
-		Artist          string `json:"artist"`
-		SkippedSections []struct {
-			ID        int `json:"id"`
-			StartTime int `json:"start_time"`
-			EndTime   int `json:"end_time"`
-		} `json:"skipped_sections"`
+	songID, ok := songIDParam(c)
+	if !ok {
+		return
 	}
+	userID := currentUserID(c)
 
-	err := db.QueryRow(context.Background(),
-		"SELECT song_id, title, artist FROM songs WHERE song_id = $1", songID).
-		Scan(&song.SongID, &song.Title, &song.Artist)
+	// By default the song is only marked deleted so it can be restored later
+	if c.Query("hard") != "true" {
+		err := songRepo.SoftDelete(ctx, userID, songID)
+		if errors.Is(err, errSongNotFound) {
+			respondErrorCode(c, http.StatusNotFound, codeSongNotFound, "Song not found")
+			return
+		}
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to delete song: "+err.Error())
+			return
+		}
 
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "error: Song not found"})
+		respond(c, http.StatusOK, "Song deleted successfully!", nil)
 		return
 	}
 
-	rows, err := db.Query(context.Background(),
-		"SELECT id, start_time, end_time, created_at FROM skipped_sections WHERE song_id = $1", songID)
+	// Permanent deletion is reserved for admins
+	if !isAdmin(c) {
+		respondErrorCode(c, http.StatusForbidden, codeAdminRequired, "Only admins can permanently delete songs")
+		return
+	}
 
+	err := songRepo.HardDelete(ctx, userID, songID)
+	if errors.Is(err, errSongNotFound) {
+		respondErrorCode(c, http.StatusNotFound, codeSongNotFound, "Song not found")
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "error: Failed to retrieve skipped sections"})
+		respondError(c, http.StatusInternalServerError, "Failed to delete song: "+err.Error())
 		return
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var section struct {
-			ID        int `json:"id"`
-			StartTime int `json:"start_time"`
-			EndTime   int `json:"end_time"`
-		}
-		if err := rows.Scan(&section.ID, &section.StartTime, &section.EndTime); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "error: Failed to process skipped sections"})
+	respond(c, http.StatusOK, "Song permanently deleted successfully!", nil)
+}
+
+// Deletes many songs at once in a single transaction. Like deleteSong, songs are only
+// marked deleted unless an admin asks for them and their sections to be removed for good.
+// IDs that don't match a song of the user are ignored and left out of the count.
+//
+//	@Summary	Delete many songs at once
+//	@Tags		songs
+//	@Accept		json
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		request	body	deleteSongsRequest	true	"Songs to delete, at most 500"
+//	@Param		hard	query	bool	false	"Permanently delete the songs and their sections (admins only)"
+//	@Success	200	{object}	envelope{data=deletedCountResponse}
+//	@Failure	400	{object}	errorResponse
+//	@Failure	403	{object}	errorResponse
+//	@Failure	415	{object}	errorResponse
+//	@Router		/v1/deleteSongs [post]
+func deleteSongs(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	var request deleteSongsRequest
+
+	if !bindJSON(c, &request) {
+		return
+	}
+	if len(request.SongIDs) > maxBulkSongs {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("Invalid request: at most %d songs can be deleted at once", maxBulkSongs))
+		return
+	}
+
+	songIDs := make([]string, len(request.SongIDs))
+	for i, id := range request.SongIDs {
+		songID, err := normalizeSpotifyTrackID(id)
+		if err != nil {
+			respondErrorCode(c, http.StatusBadRequest, codeInvalidSongID, fmt.Sprintf("Invalid song ID at index %d: %v", i, err))
 			return
 		}
-		song.SkippedSections = append(song.SkippedSections, section)
+		songIDs[i] = songID
+	}
+
+	hard := c.Query("hard") == "true"
+	if hard && !isAdmin(c) {
+		respondErrorCode(c, http.StatusForbidden, codeAdminRequired, "Only admins can permanently delete songs")
+		return
+	}
+
+	deletedCount, err := songRepo.DeleteMany(ctx, currentUserID(c), songIDs, hard)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to delete songs: "+err.Error())
+		return
 	}
 
-	c.JSON(http.StatusOK, song)
+	respond(c, http.StatusOK, "Songs deleted successfully!", gin.H{"deleted_count": deletedCount})
 }
 
-// Retrieves all songs from the database
-func getSongs(c *gin.Context) {
-	rows, err := db.Query(context.Background(), "SELECT song_id, title, artist FROM songs")
+// Restore a soft-deleted song
+//
+//	@Summary	Restore a deleted song
+//	@Tags		songs
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		id	path	string	true	"Song ID"
+//	@Success	200	{object}	envelope
+//	@Failure	400	{object}	errorResponse
+//	@Failure	404	{object}	errorResponse
+//	@Router		/v1/songs/{id}/restore [post]
+func restoreSong(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	songID, ok := songIDParam(c)
+	if !ok {
+		return
+	}
+
+	err := songRepo.Restore(ctx, currentUserID(c), songID)
+	if errors.Is(err, errSongNotFound) {
+		respondErrorCode(c, http.StatusNotFound, codeSongNotFound, "Deleted song not found")
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to restore song: "+err.Error())
+		return
+	}
+
+	respond(c, http.StatusOK, "Song restored successfully!", nil)
+}
+
+// Replaces every editable field of a song. Title and artist are required; an omitted
+// duration clears it, as a full replacement should.
+//
+//	@Summary	Replace a song
+//	@Tags		songs
+//	@Accept		json
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		id	path	string	true	"Song ID"
+//	@Param		song	body	songReplaceRequest	true	"The song's new fields"
+//	@Param		If-Unmodified-Since	header	string	false	"Only update if the song hasn't changed since this HTTP date"
+//	@Success	200	{object}	envelope{data=songUpdateResponse}
+//	@Failure	400	{object}	errorResponse
+//	@Failure	404	{object}	errorResponse
+//	@Failure	412	{object}	errorResponse
+//	@Failure	415	{object}	errorResponse
+//	@Router		/v1/songs/{id} [put]
+//	@Router		/v1/updateSong/{id} [put]
+func replaceSong(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	songID, ok := songIDParam(c)
+	if !ok {
+		return
+	}
+
+	var song songReplaceRequest
+
+	if !bindJSON(c, &song) {
+		return
+	}
+	if song.Title == nil || song.Artist == nil {
+		respondError(c, http.StatusBadRequest, "Invalid request: title and artist are required, use PATCH /songs/:id to change only some fields")
+		return
+	}
+	*song.Title, *song.Artist = normalizeText(*song.Title), normalizeText(*song.Artist)
+	if *song.Title == "" || *song.Artist == "" {
+		respondError(c, http.StatusBadRequest, "Invalid request: title and artist must not be blank")
+		return
+	}
+	if err := validateDuration(song.Duration); err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidDuration, "Invalid request: "+err.Error())
+		return
+	}
+	before, ok := unmodifiedBefore(c, song.UpdatedAt)
+	if !ok {
+		return
+	}
+	duplicateOf, ok := findDuplicateSong(c, ctx, songID, *song.Title, *song.Artist)
+	if !ok {
+		return
+	}
+
+	updated, err := songRepo.Replace(ctx, currentUserID(c), songID, song, before)
+
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "error: Failed to retrieve songs: " + err.Error()})
+		respondError(c, http.StatusInternalServerError, "Failed to update song: "+err.Error())
+		return
+	}
+	if !updated {
+		respondSongNotUpdated(c, ctx, songID)
+		return
+	}
+
+	respond(c, http.StatusOK, "Song updated successfully!", songUpdateResponse{PossibleDuplicateOf: duplicateOf})
+}
+
+// Changes only the fields present in the request, leaving the rest as they are
+//
+//	@Summary	Update some fields of a song
+//	@Tags		songs
+//	@Accept		json
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		id	path	string	true	"Song ID"
+//	@Param		song	body	songUpdateRequest	true	"Fields to change"
+//	@Param		If-Unmodified-Since	header	string	false	"Only update if the song hasn't changed since this HTTP date"
+//	@Success	200	{object}	envelope{data=songUpdateResponse}
+//	@Failure	400	{object}	errorResponse
+//	@Failure	404	{object}	errorResponse
+//	@Failure	412	{object}	errorResponse
+//	@Failure	415	{object}	errorResponse
+//	@Router		/v1/songs/{id} [patch]
+func patchSong(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	songID, ok := songIDParam(c)
+	if !ok {
 		return
 	}
-	defer rows.Close()
 
-	var songs []struct {
-		SongID string `json:"song_id"`
-		Title  string `json:"title"`
-		Artist string `json:"artist"`
+	// Pointers tell an omitted field apart from an empty one so omitted fields stay unchanged
+	var song songUpdateRequest
+
+	if !bindJSON(c, &song) {
+		return
+	}
+	if song.Title == nil && song.Artist == nil && song.Duration == nil {
+		respondError(c, http.StatusBadRequest, "Invalid request: no fields to update")
+		return
+	}
+	for _, field := range []*string{song.Title, song.Artist} {
+		if field == nil {
+			continue
+		}
+		if *field = normalizeText(*field); *field == "" {
+			respondError(c, http.StatusBadRequest, "Invalid request: title and artist must not be blank")
+			return
+		}
+	}
+	if err := validateDuration(song.Duration); err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidDuration, "Invalid request: "+err.Error())
+		return
+	}
+	before, ok := unmodifiedBefore(c, song.UpdatedAt)
+	if !ok {
+		return
 	}
 
-	for rows.Next() {
-		var song struct {
-			SongID string `json:"song_id"`
-			Title  string `json:"title"`
-			Artist string `json:"artist"`
+	// A changed title or artist is checked for duplicates together with the stored other half
+	var duplicateOf *string
+	if song.Title != nil || song.Artist != nil {
+		stored, err := songRepo.GetByID(ctx, currentUserID(c), songID)
+		if errors.Is(err, errSongNotFound) {
+			respondErrorCode(c, http.StatusNotFound, codeSongNotFound, "Song not found")
+			return
 		}
-		if err := rows.Scan(&song.SongID, &song.Title, &song.Artist); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "error: Failed to retrieve songs: " + err.Error()})
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to retrieve song: "+err.Error())
+			return
+		}
+		if song.Title != nil {
+			stored.Title = *song.Title
+		}
+		if song.Artist != nil {
+			stored.Artist = *song.Artist
+		}
+		duplicateOf, ok = findDuplicateSong(c, ctx, songID, stored.Title, stored.Artist)
+		if !ok {
 			return
 		}
-		songs = append(songs, song)
 	}
 
-	// Check if there were any errors during the iteration
-	if err := rows.Err(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "error: Failed to iterate over songs: " + err.Error()})
+	updated, err := songRepo.Patch(ctx, currentUserID(c), songID, song, before)
+
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to update song: "+err.Error())
+		return
+	}
+	if !updated {
+		respondSongNotUpdated(c, ctx, songID)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Songs retrieved successfully!",
-		"songs":   songs})
+	respond(c, http.StatusOK, "Song updated successfully!", songUpdateResponse{PossibleDuplicateOf: duplicateOf})
 }
 
-// Delete a song by ID
-func deleteSong(c *gin.Context) {
-	songID := c.Param("id")
+// Reads the optimistic concurrency check of a song update: the If-Unmodified-Since header
+// or the updated_at the client last saw. Returns the time the stored updated_at must be
+// before for the update to go ahead, or nil when the client sent neither. The header only
+// has second precision, so any change within its second still counts as unmodified.
+func unmodifiedBefore(c *gin.Context, updatedAt *time.Time) (*time.Time, bool) {
+	if updatedAt != nil {
+		limit := updatedAt.Add(time.Microsecond)
+		return &limit, true
+	}
+
+	header := c.GetHeader("If-Unmodified-Since")
+	if header == "" {
+		return nil, true
+	}
+	since, err := http.ParseTime(header)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "If-Unmodified-Since must be an HTTP date")
+		return nil, false
+	}
+	limit := since.Add(time.Second)
+	return &limit, true
+}
+
+// Looks for another of the user's songs with this artist and title, which is usually the
+// same track under another ID. Distinct tracks such as remasters and live versions can
+// share both, so a match is only reported back for the client to merge if it wants to.
+// Returns the other song's ID, nil when there is none, and whether the request may go on.
+func findDuplicateSong(c *gin.Context, ctx context.Context, songID, title, artist string) (*string, bool) {
+	duplicateID, found, err := songRepo.FindDuplicate(ctx, currentUserID(c), songID, title, artist)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to check for duplicate songs: "+err.Error())
+		return nil, false
+	}
+	if !found {
+		return nil, true
+	}
+	return &duplicateID, true
+}
+
+// after the client's precondition, 404 otherwise
+func respondSongNotUpdated(c *gin.Context, ctx context.Context, songID string) {
+	exists, err := songRepo.Exists(ctx, currentUserID(c), songID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to check if song exists: "+err.Error())
+		return
+	}
+	if exists {
+		respondErrorCode(c, http.StatusPreconditionFailed, codeSongModified, "Song was modified since it was last read, fetch it again before updating")
+		return
+	}
+	respondErrorCode(c, http.StatusNotFound, codeSongNotFound, "Song not found")
+}
 
-	_, err := db.Exec(context.Background(),
-		"DELETE FROM songs WHERE song_id = $1", songID)
+// Update the start and end time of a single skipped section
+//
+//	@Summary	Update a skipped section
+//	@Tags		sections
+//	@Accept		json
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		id	path	int	true	"Skipped section ID"
+//	@Param		section	body	sectionInput	true	"New start and end time"
+//	@Success	200	{object}	envelope
+//	@Failure	400	{object}	errorResponse
+//	@Failure	404	{object}	errorResponse
+//	@Failure	415	{object}	errorResponse
+//	@Router		/v1/skippedSection/{id} [put]
+func updateSkippedSection(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
 
+	sectionID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "error: Failed to delete song: " + err.Error()})
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidSectionID, "Invalid skipped section ID")
+		return
+	}
+
+	var section sectionInput
+
+	if !bindJSON(c, &section) {
+		return
+	}
+
+	// The same checks as adding a section: valid times within the song, no overlap with
+	// the song's other sections, and a song that still exists
+	err = songRepo.UpdateSkippedSection(ctx, currentUserID(c), sectionID, section)
+	var invalid *invalidSectionError
+	var overlap *sectionOverlapError
+	switch {
+	case errors.Is(err, errSectionNotFound):
+		respondErrorCode(c, http.StatusNotFound, codeSectionNotFound, "Skipped section not found")
+		return
+	case errors.Is(err, errSongNotFound):
+		respondErrorCode(c, http.StatusNotFound, codeSongNotFound, "Song not found")
+		return
+	case errors.As(err, &invalid):
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidSection, invalid.Error())
+		return
+	case errors.As(err, &overlap):
+		respondErrorCode(c, http.StatusBadRequest, codeSectionOverlap, overlap.Error())
+		return
+	case err != nil:
+		respondError(c, http.StatusInternalServerError, "Failed to update skipped section: "+err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Song deleted successfully!"})
+	respond(c, http.StatusOK, "Skipped section updated successfully!", nil)
 }
 
-// Update a song
-func updateSong(c *gin.Context) {
-	songID := c.Param("id")
+// Switches a skipped section off, or back on, without touching its boundaries.
+// Disabled sections are left out of song details and the skip map by default.
+//
+//	@Summary	Enable or disable a skipped section
+//	@Tags		sections
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		id	path	int	true	"Skipped section ID"
+//	@Success	200	{object}	envelope{data=skippedSectionResponse}
+//	@Failure	400	{object}	errorResponse
+//	@Failure	404	{object}	errorResponse
+//	@Router		/v1/skippedSection/{id}/toggle [patch]
+func toggleSkippedSection(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
 
-	var song struct {
-		Title  string `json:"title"`
-		Artist string `json:"artist"`
+	sectionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidSectionID, "Invalid skipped section ID")
+		return
+	}
+
+	section, err := songRepo.ToggleSkippedSection(ctx, currentUserID(c), sectionID)
+
+	if errors.Is(err, errSectionNotFound) {
+		respondErrorCode(c, http.StatusNotFound, codeSectionNotFound, "Skipped section not found")
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to toggle skipped section: "+err.Error())
+		return
+	}
+
+	message := "Skipped section disabled successfully!"
+	if section.Enabled {
+		message = "Skipped section enabled successfully!"
 	}
+	respond(c, http.StatusOK, message, gin.H{"skipped_section": section})
+}
 
-	if err := c.ShouldBindJSON(&song); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "error: Invalid request: " + err.Error()})
+// Delete a single skipped section by ID
+//
+//	@Summary	Delete a skipped section
+//	@Tags		sections
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Param		id	path	int	true	"Skipped section ID"
+//	@Success	200	{object}	envelope
+//	@Failure	400	{object}	errorResponse
+//	@Failure	404	{object}	errorResponse
+//	@Router		/v1/skippedSection/{id} [delete]
+func deleteSkippedSection(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	sectionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondErrorCode(c, http.StatusBadRequest, codeInvalidSectionID, "Invalid skipped section ID")
 		return
 	}
 
-	_, err := db.Exec(context.Background(),
-		"UPDATE songs SET title = $1, artist = $2 WHERE song_id = $3",
-		song.Title, song.Artist, songID)
+	err = songRepo.DeleteSkippedSection(ctx, currentUserID(c), sectionID)
 
+	if errors.Is(err, errSectionNotFound) {
+		respondErrorCode(c, http.StatusNotFound, codeSectionNotFound, "Skipped section not found")
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "error: Failed to update song: " + err.Error()})
+		respondError(c, http.StatusInternalServerError, "Failed to delete skipped section: "+err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Song updated successfully!"})
+	respond(c, http.StatusOK, "Skipped section deleted successfully!", nil)
 }
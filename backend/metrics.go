@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Number of responses that returned skipped sections (song details, batches and
+// skip maps) since the server started
+var skipFetches atomic.Int64
+
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "spotiskip_http_requests_total",
+		Help: "Number of HTTP requests handled, by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "spotiskip_http_request_duration_seconds",
+		Help:    "Time taken to handle HTTP requests, by route, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	_ = promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "spotiskip_skip_fetches_total",
+		Help: "Responses that returned skipped sections to a client.",
+	}, func() float64 {
+		return float64(skipFetches.Load())
+	})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "spotiskip_db_active_connections",
+		Help: "Database connections currently acquired from the pool.",
+	}, func() float64 {
+		stat := poolStat()
+		if stat == nil {
+			return 0
+		}
+		return float64(stat.AcquiredConns())
+	})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "spotiskip_db_total_connections",
+		Help: "Database connections currently open in the pool.",
+	}, func() float64 {
+		stat := poolStat()
+		if stat == nil {
+			return 0
+		}
+		return float64(stat.TotalConns())
+	})
+)
+
+// Records request counts and latencies labeled by the matched route template
+func metricsMiddleware(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	// Unmatched paths share one label so arbitrary URLs can't explode the series count
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	status := strconv.Itoa(c.Writer.Status())
+
+	httpRequestsTotal.WithLabelValues(route, c.Request.Method, status).Inc()
+	httpRequestDuration.WithLabelValues(route, c.Request.Method, status).Observe(time.Since(start).Seconds())
+}
+
+// Reports totals across all users: stored songs and sections, and how often skip data
+// was fetched. Admins only.
+//
+//	@Summary	Usage statistics
+//	@Tags		system
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Success	200	{object}	envelope{data=statsResponse}
+//	@Failure	401	{object}	errorResponse
+//	@Failure	403	{object}	errorResponse
+//	@Router		/stats [get]
+func getStats(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	var stats statsResponse
+	var err error
+	stats.TotalSongs, stats.TotalSections, err = songRepo.CountAll(ctx)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve stats: "+err.Error())
+		return
+	}
+	stats.TotalFetches = skipFetches.Load()
+
+	respond(c, http.StatusOK, "", stats)
+}
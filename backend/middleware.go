@@ -0,0 +1,411 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Adds CORS headers for allowed origins and answers preflight requests.
+// Origins come from CORS_ORIGINS (comma-separated). When it is unset, every origin
+// is denied unless APP_ENV is "development", where any origin is allowed.
+func corsMiddleware() gin.HandlerFunc {
+	allowedOrigins := envList("CORS_ORIGINS")
+	if len(allowedOrigins) == 0 && os.Getenv("APP_ENV") == "development" {
+		allowedOrigins = []string{"*"}
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		c.Header("Vary", "Origin")
+		if !slices.Contains(allowedOrigins, "*") && !slices.Contains(allowedOrigins, origin) {
+			// Disallowed origins get no CORS headers, so the browser blocks the response
+			if c.Request.Method == http.MethodOptions {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Unmodified-Since, Idempotency-Key")
+		c.Header("Access-Control-Expose-Headers", "Link")
+		c.Header("Access-Control-Max-Age", "600")
+
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Assigns every request an ID, echoed in the X-Request-ID header, and logs it as JSON once handled
+func requestLogger(c *gin.Context) {
+	// Scrapes of /metrics would only add noise to the logs
+	if c.Request.URL.Path == "/metrics" {
+		c.Next()
+		return
+	}
+
+	start := time.Now()
+
+	id := c.GetHeader("X-Request-ID")
+	if id == "" || len(id) > 128 {
+		id = newRequestID()
+	}
+	c.Set("requestID", id)
+	c.Header("X-Request-ID", id)
+
+	c.Next()
+
+	status := c.Writer.Status()
+	attrs := []any{
+		slog.String("request_id", id),
+		slog.String("method", c.Request.Method),
+		slog.String("path", c.Request.URL.Path),
+		slog.Int("status", status),
+		slog.Duration("latency", time.Since(start)),
+		slog.String("client_ip", c.ClientIP()),
+	}
+	if len(c.Errors) > 0 {
+		attrs = append(attrs, slog.String("errors", c.Errors.String()))
+	}
+
+	switch {
+	case status >= http.StatusInternalServerError:
+		slog.Error("request failed", attrs...)
+	case status >= http.StatusBadRequest:
+		slog.Warn("request rejected", attrs...)
+	default:
+		slog.Info("request handled", attrs...)
+	}
+}
+
+// Turns a panic in a later handler into a JSON 500 carrying the request ID. The panic
+// value and stack trace are logged but never sent to the client.
+func recovery(c *gin.Context) {
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+		// The client went away; there is no one to answer
+		if recovered == http.ErrAbortHandler {
+			panic(recovered)
+		}
+
+		slog.Error("panic recovered",
+			slog.String("request_id", requestID(c)),
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.Any("panic", recovered),
+			slog.String("stack", string(debug.Stack())))
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse{Error: apiError{
+			Code:      codeInternal,
+			Message:   "internal server error",
+			RequestID: requestID(c)}})
+	}()
+
+	c.Next()
+}
+
+// Returns the ID requestLogger assigned to this request
+func requestID(c *gin.Context) string {
+	return c.GetString("requestID")
+}
+
+// Generates a random version 4 UUID
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Version of the response shapes this server speaks
+const apiVersion = "1"
+
+// Returns the matched route with any version prefix removed, since versioned and
+// unversioned paths are the same route
+func unversionedRoute(c *gin.Context) string {
+	return strings.TrimPrefix(c.FullPath(), "/v"+apiVersion)
+}
+
+// Vendor media type clients may put in Accept to ask for a version, as in application/vnd.spotiskip.v1+json
+const versionedMediaTypePrefix, versionedMediaTypeSuffix = "application/vnd.spotiskip.v", "+json"
+
+// Reports the API version in the X-API-Version header. Clients that ask for a version
+// through Accept get 406 unless it is one this server speaks.
+func apiVersionNegotiation(c *gin.Context) {
+	c.Header("X-API-Version", apiVersion)
+
+	var requested []string
+	for _, accepted := range strings.Split(c.GetHeader("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(strings.TrimSpace(accepted), ";")
+		version, ok := strings.CutPrefix(mediaType, versionedMediaTypePrefix)
+		if !ok {
+			continue
+		}
+		version, ok = strings.CutSuffix(version, versionedMediaTypeSuffix)
+		if !ok {
+			continue
+		}
+		if version == apiVersion {
+			c.Next()
+			return
+		}
+		requested = append(requested, version)
+	}
+
+	if len(requested) > 0 {
+		abortWithError(c, http.StatusNotAcceptable,
+			fmt.Sprintf("API version %s is not supported, this server speaks version %s", strings.Join(requested, ", "), apiVersion))
+		return
+	}
+	c.Next()
+}
+
+// Per-client token bucket used by rateLimiter
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// Limits each client IP to rps requests per second with bursts of up to burst requests.
+// Requests over the limit get 429 with a Retry-After header. /health and /ping are never limited.
+// Idle clients are forgotten every minute until ctx is cancelled.
+func rateLimiter(ctx context.Context, rps float64, burst int) gin.HandlerFunc {
+	var (
+		mu      sync.Mutex
+		buckets = map[string]*tokenBucket{}
+	)
+
+	// Forget clients that have been idle long enough to have a full bucket again
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				mu.Lock()
+				for ip, bucket := range buckets {
+					if time.Since(bucket.lastSeen) > time.Duration(float64(burst)/rps*float64(time.Second))+time.Minute {
+						delete(buckets, ip)
+					}
+				}
+				mu.Unlock()
+			}
+		}
+	}()
+
+	return func(c *gin.Context) {
+		if c.Request.URL.Path == "/health" || c.Request.URL.Path == "/ping" {
+			c.Next()
+			return
+		}
+
+		now := time.Now()
+		ip := c.ClientIP()
+
+		mu.Lock()
+		bucket, ok := buckets[ip]
+		if !ok {
+			bucket = &tokenBucket{tokens: float64(burst), lastSeen: now}
+			buckets[ip] = bucket
+		}
+		bucket.tokens = math.Min(float64(burst), bucket.tokens+now.Sub(bucket.lastSeen).Seconds()*rps)
+		bucket.lastSeen = now
+
+		allowed := bucket.tokens >= 1
+		if allowed {
+			bucket.tokens--
+		}
+		retryAfter := math.Ceil((1 - bucket.tokens) / rps)
+		mu.Unlock()
+
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(retryAfter)))
+			abortWithError(c, http.StatusTooManyRequests, "Rate limit exceeded, try again later")
+			return
+		}
+		c.Next()
+	}
+}
+
+// Set from READ_ONLY; while true, writable refuses every route that changes data
+var readOnly bool
+
+// Answers 503 instead of running the route while the server is read-only. Applied to
+// every route that changes data; reads keep working.
+func writable(c *gin.Context) {
+	if readOnly {
+		abortWithErrorCode(c, http.StatusServiceUnavailable, codeReadOnly, "The service is in read-only maintenance, try again later")
+		return
+	}
+	c.Next()
+}
+
+// Limits request bodies to maxBytes, or to the route's entry in routeLimits. Bodies that
+// declare a larger Content-Length are rejected up front; others are cut off while being
+// read, which bindJSON reports as 413.
+func bodyLimit(defaultMaxBytes int64, routeLimits map[string]int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		maxBytes, ok := routeLimits[unversionedRoute(c)]
+		if !ok {
+			maxBytes = defaultMaxBytes
+		}
+
+		if c.Request.ContentLength > maxBytes {
+			abortWithError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body exceeds %d bytes", maxBytes))
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		c.Next()
+	}
+}
+
+// Bounds every request by timeout so no handler can hang indefinitely. Queries run on
+// the request context, so they are cancelled with it and the handler's error is turned
+// into a 503 by respondErrorCode; a handler that returns without answering gets one here.
+func requestTimeout(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Event streams stay open for as long as the client listens, and exports are
+		// streamed after the 200 is sent, so cutting them off would truncate the document
+		if route := unversionedRoute(c); route == "/skipStream" || route == "/export" {
+			c.Next()
+			return
+		}
+
+		// Routes allowed longer queries also get that long to answer
+		ctx, cancel := context.WithTimeout(c.Request.Context(), max(timeout, routeQueryTimeouts[unversionedRoute(c)]))
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && !c.Writer.Written() {
+			respondTimeout(c)
+		}
+	}
+}
+
+// Compresses responses of at least minSize bytes for clients that accept gzip.
+// Smaller responses are sent as is, since compressing them costs more than it saves.
+func gzipMiddleware(minSize int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Prometheus compresses /metrics itself
+		if !strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") || c.Request.URL.Path == "/metrics" {
+			c.Next()
+			return
+		}
+
+		writer := &gzipResponseWriter{ResponseWriter: c.Writer, minSize: minSize}
+		c.Writer = writer
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+
+		defer func() {
+			writer.finish()
+			c.Writer = writer.ResponseWriter
+		}()
+		c.Next()
+	}
+}
+
+// Buffers the start of a response until it is known whether it reaches the
+// compression threshold, then either gzips it or passes it through unchanged
+type gzipResponseWriter struct {
+	gin.ResponseWriter
+	minSize int
+	buffer  []byte
+	gz      *gzip.Writer
+	decided bool
+}
+
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	if w.decided {
+		if w.gz != nil {
+			return w.gz.Write(data)
+		}
+		return w.ResponseWriter.Write(data)
+	}
+
+	w.buffer = append(w.buffer, data...)
+	if len(w.buffer) >= w.minSize {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *gzipResponseWriter) WriteString(data string) (int, error) {
+	return w.Write([]byte(data))
+}
+
+// Streaming responses can't wait for the threshold, so a flush sends what is buffered uncompressed
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Sends the buffered bytes, compressed or not, and routes later writes the same way
+func (w *gzipResponseWriter) decide(compress bool) error {
+	w.decided = true
+	if compress {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+		_, err := w.gz.Write(w.buffer)
+		w.buffer = nil
+		return err
+	}
+	if len(w.buffer) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.buffer)
+	w.buffer = nil
+	return err
+}
+
+// Writes out whatever is still pending once the handler has returned
+func (w *gzipResponseWriter) finish() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
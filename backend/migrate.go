@@ -0,0 +1,69 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Applies any pending migrations from the embedded migrations directory
+func runMigrations() {
+	m, err := newMigrator()
+	if err != nil {
+		log.Fatalf("error: Unable to initialize migrations: %v", err)
+	}
+	defer m.Close()
+
+	if baseline := intEnv("MIGRATE_BASELINE", 0); baseline > 0 {
+		baselineMigrations(m, baseline)
+	}
+
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		log.Fatalf("error: Unable to run migrations: %v", err)
+	}
+
+	version, _, _ := m.Version()
+	fmt.Println("Database migrated to version", version)
+}
+
+// Marks a database whose tables were created before migrations were tracked as
+// already at the given version, so Up only applies what comes after it. Databases
+// that already record a version are left alone.
+func baselineMigrations(m *migrate.Migrate, version int) {
+	_, _, err := m.Version()
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, migrate.ErrNilVersion) {
+		log.Fatalf("error: Unable to read migration version: %v", err)
+	}
+
+	if err := m.Force(version); err != nil {
+		log.Fatalf("error: Unable to baseline migrations at version %d: %v", version, err)
+	}
+	fmt.Println("Database baselined at migration version", version)
+}
+
+// Prepares the embedded migrations to run against the configured database
+func newMigrator() (*migrate.Migrate, error) {
+	source, err := iofs.New(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("load migrations: %w", err)
+	}
+
+	// The pgx/v5 migrate driver registers itself under the pgx5 scheme, whether the
+	// URL was given as postgres:// or postgresql://
+	_, rest, _ := strings.Cut(databaseURL(), "://")
+	migrationURL := "pgx5://" + rest
+
+	return migrate.NewWithSourceInstance("iofs", source, migrationURL)
+}
@@ -0,0 +1,8 @@
+CREATE TABLE songs (
+    user_id    TEXT NOT NULL,
+    song_id    TEXT NOT NULL,
+    title      TEXT NOT NULL DEFAULT '',
+    artist     TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, song_id)
+);
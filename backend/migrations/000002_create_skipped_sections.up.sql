@@ -0,0 +1,12 @@
+CREATE TABLE skipped_sections (
+    id         SERIAL PRIMARY KEY,
+    user_id    TEXT NOT NULL,
+    song_id    TEXT NOT NULL,
+    start_time INTEGER NOT NULL CHECK (start_time >= 0),
+    end_time   INTEGER NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (end_time > start_time),
+    FOREIGN KEY (user_id, song_id) REFERENCES songs (user_id, song_id) ON DELETE CASCADE
+);
+
+CREATE INDEX skipped_sections_user_song_idx ON skipped_sections (user_id, song_id);
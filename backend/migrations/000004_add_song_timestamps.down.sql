@@ -0,0 +1,3 @@
+-- created_at belongs to 000001 now, so only updated_at is removed here
+ALTER TABLE songs
+    DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS skipped_sections_touch_song ON skipped_sections;
+DROP FUNCTION IF EXISTS touch_song_skips();
+ALTER TABLE songs DROP COLUMN IF EXISTS skips_updated_at;
@@ -0,0 +1,18 @@
+-- Records when a song's skipped sections last changed so clients can fetch only deltas
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS skips_updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE OR REPLACE FUNCTION touch_song_skips() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        UPDATE songs SET skips_updated_at = now() WHERE user_id = OLD.user_id AND song_id = OLD.song_id;
+        RETURN OLD;
+    END IF;
+    UPDATE songs SET skips_updated_at = now() WHERE user_id = NEW.user_id AND song_id = NEW.song_id;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS skipped_sections_touch_song ON skipped_sections;
+CREATE TRIGGER skipped_sections_touch_song
+    AFTER INSERT OR UPDATE OR DELETE ON skipped_sections
+    FOR EACH ROW EXECUTE FUNCTION touch_song_skips();
@@ -0,0 +1 @@
+ALTER TABLE skipped_sections DROP COLUMN IF EXISTS label;
@@ -0,0 +1 @@
+ALTER TABLE skipped_sections ADD COLUMN IF NOT EXISTS label TEXT;
@@ -0,0 +1,20 @@
+-- Back to seconds, unless the values already are: the up migration comments
+-- songs.duration when it converts, and databases converted before it did so have
+-- values above 86400, which can't be seconds. Values converted from seconds come back
+-- exactly; anything stored since with a fraction of a second is rounded down.
+DO $$
+BEGIN
+    IF (SELECT col_description(attrelid, attnum) FROM pg_attribute
+            WHERE attrelid = 'songs'::regclass AND attname = 'duration') = 'milliseconds'
+        OR EXISTS (SELECT 1 FROM songs WHERE duration > 86400)
+        OR EXISTS (SELECT 1 FROM skipped_sections WHERE end_time > 86400)
+    THEN
+        UPDATE songs SET duration = GREATEST(duration / 1000, 1) WHERE duration IS NOT NULL;
+        UPDATE skipped_sections SET start_time = start_time / 1000, end_time = GREATEST(end_time / 1000, start_time / 1000 + 1);
+    END IF;
+END
+$$;
+
+COMMENT ON COLUMN songs.duration IS NULL;
+COMMENT ON COLUMN skipped_sections.start_time IS NULL;
+COMMENT ON COLUMN skipped_sections.end_time IS NULL;
@@ -0,0 +1,24 @@
+-- Song durations and skipped section times were stored in seconds; store milliseconds
+-- to match the positions reported by Spotify's player.
+--
+-- The conversion runs at most once. The comment on songs.duration records that it
+-- happened, and a stored value above 86400, more than 24 hours in seconds, can only be
+-- milliseconds already. Either way nothing is multiplied again, so applying this to a
+-- database that is already converted, for example after forcing its version back,
+-- leaves the values alone.
+DO $$
+BEGIN
+    IF (SELECT col_description(attrelid, attnum) FROM pg_attribute
+            WHERE attrelid = 'songs'::regclass AND attname = 'duration') IS DISTINCT FROM 'milliseconds'
+        AND NOT EXISTS (SELECT 1 FROM songs WHERE duration > 86400)
+        AND NOT EXISTS (SELECT 1 FROM skipped_sections WHERE end_time > 86400)
+    THEN
+        UPDATE songs SET duration = duration * 1000 WHERE duration IS NOT NULL;
+        UPDATE skipped_sections SET start_time = start_time * 1000, end_time = end_time * 1000;
+    END IF;
+END
+$$;
+
+COMMENT ON COLUMN songs.duration IS 'milliseconds';
+COMMENT ON COLUMN skipped_sections.start_time IS 'milliseconds';
+COMMENT ON COLUMN skipped_sections.end_time IS 'milliseconds';
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS skip_events (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    TEXT NOT NULL,
+    song_id    TEXT NOT NULL,
+    section_id INTEGER REFERENCES skipped_sections (id) ON DELETE SET NULL,
+    skipped_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    FOREIGN KEY (user_id, song_id) REFERENCES songs (user_id, song_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS skip_events_user_song_idx ON skip_events (user_id, song_id, skipped_at);
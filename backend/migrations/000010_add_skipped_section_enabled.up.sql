@@ -0,0 +1,2 @@
+-- Lets users switch a skip off without losing its boundaries
+ALTER TABLE skipped_sections ADD COLUMN IF NOT EXISTS enabled BOOLEAN NOT NULL DEFAULT true;
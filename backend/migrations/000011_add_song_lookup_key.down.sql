@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS songs_user_lookup_key_idx;
+ALTER TABLE songs DROP COLUMN IF EXISTS lookup_key;
@@ -0,0 +1,11 @@
+-- Tidy up whitespace stored before the API normalized it
+UPDATE songs SET
+    title = regexp_replace(btrim(title), '\s+', ' ', 'g'),
+    artist = regexp_replace(btrim(artist), '\s+', ' ', 'g')
+WHERE title ~ '(^\s|\s$|\s\s)' OR artist ~ '(^\s|\s$|\s\s)';
+
+-- Case-insensitive form of artist and title for finding duplicates and searching;
+-- title and artist keep their display casing
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS lookup_key TEXT GENERATED ALWAYS AS (lower(artist || ' - ' || title)) STORED;
+
+CREATE INDEX IF NOT EXISTS songs_user_lookup_key_idx ON songs (user_id, lookup_key);
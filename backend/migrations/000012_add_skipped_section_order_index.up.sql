@@ -0,0 +1,2 @@
+-- Display order chosen by the user; sections never reordered have none and follow by start time
+ALTER TABLE skipped_sections ADD COLUMN IF NOT EXISTS order_index INTEGER;
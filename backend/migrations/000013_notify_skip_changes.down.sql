@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS songs_notify_skip_changes ON songs;
+DROP FUNCTION IF EXISTS notify_skip_changes();
@@ -0,0 +1,24 @@
+-- Announces every change to a song or its skipped sections on the skip_changes channel,
+-- so servers can tell clients to refresh. Section changes reach songs through
+-- skips_updated_at, which touch_song_skips keeps current.
+CREATE OR REPLACE FUNCTION notify_skip_changes() RETURNS trigger AS $$
+DECLARE
+    song RECORD;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        song := OLD;
+    ELSE
+        song := NEW;
+    END IF;
+    PERFORM pg_notify('skip_changes', json_build_object(
+        'user_id', song.user_id,
+        'song_id', song.song_id,
+        'changed_at', now())::text);
+    RETURN song;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS songs_notify_skip_changes ON songs;
+CREATE TRIGGER songs_notify_skip_changes
+    AFTER INSERT OR DELETE OR UPDATE OF skips_updated_at ON songs
+    FOR EACH ROW EXECUTE FUNCTION notify_skip_changes();
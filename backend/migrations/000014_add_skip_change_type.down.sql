@@ -0,0 +1,16 @@
+CREATE OR REPLACE FUNCTION notify_skip_changes() RETURNS trigger AS $$
+DECLARE
+    song RECORD;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        song := OLD;
+    ELSE
+        song := NEW;
+    END IF;
+    PERFORM pg_notify('skip_changes', json_build_object(
+        'user_id', song.user_id,
+        'song_id', song.song_id,
+        'changed_at', now())::text);
+    RETURN song;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,30 @@
+-- Says what kind of change each skip_changes notification is about
+CREATE OR REPLACE FUNCTION notify_skip_changes() RETURNS trigger AS $$
+DECLARE
+    song RECORD;
+    change TEXT;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        song := NEW;
+        change := 'song_added';
+    ELSIF TG_OP = 'DELETE' THEN
+        song := OLD;
+        change := 'song_deleted';
+    ELSIF NEW.deleted_at IS NOT NULL AND OLD.deleted_at IS NULL THEN
+        song := NEW;
+        change := 'song_deleted';
+    ELSIF NEW.deleted_at IS NULL AND OLD.deleted_at IS NOT NULL THEN
+        song := NEW;
+        change := 'song_restored';
+    ELSE
+        song := NEW;
+        change := 'sections_changed';
+    END IF;
+    PERFORM pg_notify('skip_changes', json_build_object(
+        'user_id', song.user_id,
+        'song_id', song.song_id,
+        'change', change,
+        'changed_at', now())::text);
+    RETURN song;
+END;
+$$ LANGUAGE plpgsql;
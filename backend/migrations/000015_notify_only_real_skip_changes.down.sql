@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS songs_notify_skip_inserts ON songs;
+DROP TRIGGER IF EXISTS songs_notify_skip_changes ON songs;
+CREATE TRIGGER songs_notify_skip_changes
+    AFTER INSERT OR DELETE OR UPDATE OF skips_updated_at ON songs
+    FOR EACH ROW EXECUTE FUNCTION notify_skip_changes();
@@ -0,0 +1,13 @@
+-- Only announce updates that actually change skips_updated_at or deleted_at, so statements
+-- that merely list skips_updated_at, such as the addSong upsert, don't send spurious changes
+DROP TRIGGER IF EXISTS songs_notify_skip_changes ON songs;
+CREATE TRIGGER songs_notify_skip_changes
+    AFTER UPDATE OF skips_updated_at, deleted_at ON songs
+    FOR EACH ROW
+    WHEN (OLD.skips_updated_at IS DISTINCT FROM NEW.skips_updated_at OR OLD.deleted_at IS DISTINCT FROM NEW.deleted_at)
+    EXECUTE FUNCTION notify_skip_changes();
+
+DROP TRIGGER IF EXISTS songs_notify_skip_inserts ON songs;
+CREATE TRIGGER songs_notify_skip_inserts
+    AFTER INSERT OR DELETE ON songs
+    FOR EACH ROW EXECUTE FUNCTION notify_skip_changes();
@@ -0,0 +1,403 @@
+package main
+
+import "time"
+
+// Body of authCallback
+type authCallbackRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// A song as sent by clients to addSong and addSongs. addSong looks up a missing title,
+// artist or duration on Spotify; addSongs requires title and artist.
+type songRequest struct {
+	SongID   string `json:"song_id" binding:"required,max=200" example:"4uLU6hMCjMI75M1A2tKUQC"` // Track ID, URI or URL
+	Title    string `json:"title" binding:"max=300" example:"Never Gonna Give You Up"`
+	Artist   string `json:"artist" binding:"max=300" example:"Rick Astley"`
+	Duration *int   `json:"duration" example:"213573"` // Milliseconds
+}
+
+// Fields accepted by patchSong; omitted fields are left unchanged
+type songUpdateRequest struct {
+	Title     *string    `json:"title" binding:"omitempty,min=1,max=300"`
+	Artist    *string    `json:"artist" binding:"omitempty,min=1,max=300"`
+	Duration  *int       `json:"duration" example:"213573"`
+	UpdatedAt *time.Time `json:"updated_at"` // When given, the update is refused if the song changed after it
+}
+
+// Body of replaceSong; title and artist are required and an omitted duration is cleared
+type songReplaceRequest struct {
+	Title     *string    `json:"title" binding:"omitempty,min=1,max=300" example:"Never Gonna Give You Up"`
+	Artist    *string    `json:"artist" binding:"omitempty,min=1,max=300" example:"Rick Astley"`
+	Duration  *int       `json:"duration" example:"213573"`
+	UpdatedAt *time.Time `json:"updated_at"` // When given, the update is refused if the song changed after it
+}
+
+// A stored song as returned to clients
+type storedSong struct {
+	SongID    string    `json:"song_id"`
+	Title     string    `json:"title"`
+	Artist    string    `json:"artist"`
+	Duration  *int      `json:"duration"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// A stored song with the number of skipped sections it has, as listed by getSongs
+type songSummary struct {
+	storedSong
+	SkipCount int `json:"skip_count"`
+}
+
+// A stored song together with the user it belongs to, for admin listings
+type adminSong struct {
+	UserID string `json:"user_id"`
+	storedSong
+}
+
+// A song together with its skipped sections
+type songDetails struct {
+	SongID          string           `json:"song_id"`
+	Title           string           `json:"title"`
+	Artist          string           `json:"artist"`
+	Duration        *int             `json:"duration"`
+	SkippedSections []skippedSection `json:"skipped_sections"`
+	TotalSkippedMs  int              `json:"total_skipped_ms"`
+
+	// Deprecated: the total in whole seconds, rounded down, kept for clients written
+	// before times moved to milliseconds. Use total_skipped_ms.
+	TotalSkippedSeconds int `json:"total_skipped_seconds"`
+}
+
+// A stored skipped section as returned to clients
+type skippedSection struct {
+	ID        int       `json:"id"`
+	StartTime int       `json:"start_time"`
+	EndTime   int       `json:"end_time"`
+	Label     *string   `json:"label"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// A skipped section as sent by clients, optionally labelled with why it is skipped
+type sectionInput struct {
+	StartTime int     `json:"start_time" binding:"gte=0" example:"30000"` // Milliseconds from the start of the track
+	EndTime   int     `json:"end_time" binding:"gte=0" example:"45000"`   // Milliseconds from the start of the track
+	Label     *string `json:"label,omitempty" binding:"omitempty,max=100" example:"long intro"`
+}
+
+// Body of addSkippedSections
+type addSkippedSectionsRequest struct {
+	SongID          string         `json:"song_id" binding:"required"`
+	SkippedSections []sectionInput `json:"skipped_sections" binding:"dive"`
+	MergeGap        *int           `json:"merge_gap"`
+}
+
+// Body of addSkippedSectionsBatch
+type addSkippedSectionsBatchRequest struct {
+	Songs         map[string][]sectionInput `json:"songs"` // Keyed by track ID, URI or URL
+	MergeGap      *int                      `json:"merge_gap"`
+	CreateMissing bool                      `json:"create_missing"` // Create songs that don't exist yet, by ID only
+}
+
+// Body of replaceSkippedSections
+type replaceSkippedSectionsRequest struct {
+	SkippedSections []sectionInput `json:"skipped_sections" binding:"dive"`
+	MergeGap        *int           `json:"merge_gap"`
+}
+
+// Body of reorderSkippedSections
+type reorderSectionsRequest struct {
+	SectionIDs []int `json:"section_ids" binding:"required" example:"42"`
+}
+
+// Body of getSongDetailsBatch
+type songDetailsBatchRequest struct {
+	SongIDs []string `json:"song_ids" binding:"required" example:"4uLU6hMCjMI75M1A2tKUQC"`
+}
+
+// Body of deleteSongs
+type deleteSongsRequest struct {
+	SongIDs []string `json:"song_ids" binding:"required" example:"4uLU6hMCjMI75M1A2tKUQC"` // Track IDs, URIs or URLs
+}
+
+// Body of mergeSongs
+type mergeSongsRequest struct {
+	SourceSongID string `json:"source_song_id" binding:"required" example:"7GhIk7Il098yCjg4BQjzvb"`
+}
+
+// Body of addSkipEvent
+type skipEventRequest struct {
+	SongID    string     `json:"song_id" binding:"required" example:"4uLU6hMCjMI75M1A2tKUQC"`
+	SectionID *int       `json:"section_id" binding:"omitempty,gte=1" example:"42"`
+	SkippedAt *time.Time `json:"skipped_at"`
+}
+
+// A skip the player performed, as stored
+type skipEvent struct {
+	ID        int64     `json:"id"`
+	SongID    string    `json:"song_id"`
+	SectionID *int      `json:"section_id"`
+	SkippedAt time.Time `json:"skipped_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// A problem with one proposed skipped section
+type sectionIssue struct {
+	Index   int    `json:"index"`
+	Message string `json:"message"`
+}
+
+// Keyset pagination position: the sort key of the last item of the previous page.
+// Clients only see it base64-encoded, as an opaque next_cursor token.
+type pageCursor struct {
+	SongID    string     `json:"s"`
+	Sort      string     `json:"o,omitempty"` // The getSongs sort the cursor was issued for
+	Value     string     `json:"v,omitempty"` // Title or artist, when sorted by them
+	CreatedAt *time.Time `json:"c,omitempty"`
+}
+
+// Outcome of one item in an addSongs batch
+type songResult struct {
+	Index  int    `json:"index"`
+	SongID string `json:"song_id"`
+	Status string `json:"status" enums:"created,duplicate,invalid"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Outcome of one song in an addSkippedSectionsBatch request
+type songSectionsResult struct {
+	SongID          string           `json:"song_id"`
+	Status          string           `json:"status" enums:"added,invalid,not_found"`
+	Error           string           `json:"error,omitempty"`
+	SongCreated     bool             `json:"song_created"`
+	SkippedSections []skippedSection `json:"skipped_sections"`
+	AlreadyExisted  []skippedSection `json:"already_existed"`
+}
+
+// A song's skip totals across all users, for the most skipped leaderboard. Title and
+// artist come from the caller's own copy of the song, and are null when they have none,
+// so nothing another user entered is revealed.
+type mostSkippedSong struct {
+	SongID         string  `json:"song_id"`
+	Title          *string `json:"title"`
+	Artist         *string `json:"artist"`
+	SectionCount   int     `json:"section_count"`
+	TotalSkippedMs int     `json:"total_skipped_ms"`
+	UserCount      int     `json:"user_count"`
+
+	// Deprecated: the total in whole seconds, rounded down. Use total_skipped_ms.
+	TotalSkippedSeconds int `json:"total_skipped_seconds"`
+}
+
+// A skipped section with the song it belongs to and its length, for section stats
+type sectionLength struct {
+	ID        int     `json:"id"`
+	SongID    string  `json:"song_id"`
+	StartTime int     `json:"start_time"`
+	EndTime   int     `json:"end_time"`
+	LengthMs  int     `json:"length_ms"`
+	Label     *string `json:"label"`
+}
+
+// A song with its skipped sections, as written by exportData and read by importData
+type exportedSong struct {
+	SongID          string            `json:"song_id"`
+	Title           string            `json:"title"`
+	Artist          string            `json:"artist"`
+	Duration        *int              `json:"duration"`
+	SkippedSections []exportedSection `json:"skipped_sections"`
+}
+
+// A skipped section in an export. Documents written before sections could be disabled
+// have no enabled field, and their sections are imported enabled.
+type exportedSection struct {
+	sectionInput
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+// The document written by exportData and read by importData
+type exportDocument struct {
+	Version    int            `json:"version" example:"1"`
+	ExportedAt time.Time      `json:"exported_at"`
+	Songs      []exportedSong `json:"songs"`
+}
+
+// The response shapes below are for the API documentation. Successful responses carry
+// them as the data of an envelope.
+
+// Envelope of every successful response
+type envelope struct {
+	Message string `json:"message,omitempty" example:"Song retrieved successfully!"`
+	Data    any    `json:"data,omitempty"`
+}
+
+// Envelope of every error response
+type errorResponse struct {
+	Error apiError `json:"error"`
+}
+
+type apiError struct {
+	Code      errorCode    `json:"code" example:"SONG_NOT_FOUND"`
+	Message   string       `json:"message" example:"Song not found"`
+	RequestID string       `json:"request_id,omitempty"` // Only set for unexpected server errors
+	Fields    []fieldError `json:"fields,omitempty"`     // Only set for VALIDATION_FAILED
+}
+
+// A field of the request body that failed validation
+type fieldError struct {
+	Field   string `json:"field" example:"skipped_sections[0].start_time"`
+	Rule    string `json:"rule" example:"gte"`
+	Message string `json:"message" example:"skipped_sections[0].start_time must be at least 0"`
+}
+
+type healthResponse struct {
+	Status string `json:"status" example:"ok"`
+	DB     string `json:"db" example:"up"`
+}
+
+type versionResponse struct {
+	Version   string `json:"version" example:"v1.4.0"`
+	Commit    string `json:"commit" example:"6032c7b"`
+	BuildTime string `json:"build_time" example:"2026-10-15T12:00:00Z"`
+	GoVersion string `json:"go_version" example:"go1.24.1"`
+}
+
+type statsResponse struct {
+	TotalSongs    int   `json:"total_songs"`
+	TotalSections int   `json:"total_sections"`
+	TotalFetches  int64 `json:"total_fetches"` // Since the server started
+}
+
+type authResponse struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	TokenType    string    `json:"token_type"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+type songResponse struct {
+	Song storedSong `json:"song"`
+}
+
+type songListResponse struct {
+	Songs      []storedSong `json:"songs"`
+	TotalCount int          `json:"total_count"`
+	Limit      int          `json:"limit"`
+	Offset     int          `json:"offset"`
+}
+
+type songSummaryListResponse struct {
+	Songs      []songSummary `json:"songs"`
+	TotalCount int           `json:"total_count"`
+	Limit      int           `json:"limit"`
+	Offset     int           `json:"offset"`
+	NextCursor *string       `json:"next_cursor"`
+}
+
+type adminSongListResponse struct {
+	Songs      []adminSong `json:"songs"`
+	TotalCount int         `json:"total_count"`
+	Limit      int         `json:"limit"`
+	Offset     int         `json:"offset"`
+}
+
+type addSongResponse struct {
+	Status              string  `json:"status" enums:"created,updated"`
+	PossibleDuplicateOf *string `json:"possible_duplicate_of,omitempty"` // Another song with the same artist and title
+}
+
+type songUpdateResponse struct {
+	PossibleDuplicateOf *string `json:"possible_duplicate_of,omitempty"` // Another song with the same artist and title
+}
+
+type addSongsResponse struct {
+	Results []songResult `json:"results"`
+}
+
+type skippedSectionsResponse struct {
+	SkippedSections []skippedSection `json:"skipped_sections"`
+}
+
+type skippedSectionResponse struct {
+	SkippedSection skippedSection `json:"skipped_section"`
+}
+
+type addSkippedSectionsResponse struct {
+	SkippedSections []skippedSection `json:"skipped_sections"`
+	AlreadyExisted  []skippedSection `json:"already_existed"`
+}
+
+type skipAtResponse struct {
+	SkippedSection skippedSection `json:"skipped_section"`
+	SeekTo         int            `json:"seek_to" example:"45000"` // Milliseconds
+}
+
+type addSkippedSectionsBatchResponse struct {
+	Results []songSectionsResult `json:"results"`
+}
+
+type mergeSongsResponse struct {
+	SectionCount    int              `json:"section_count"`
+	SkippedSections []skippedSection `json:"skipped_sections"`
+}
+
+type skipMapResponse struct {
+	SkipMap    map[string][]sectionInput `json:"skip_map"`
+	ServerTime time.Time                 `json:"server_time"`
+	NextCursor *string                   `json:"next_cursor"`
+}
+
+type mostSkippedResponse struct {
+	Songs []mostSkippedSong `json:"songs"`
+}
+
+type sectionStatsResponse struct {
+	TotalCount      int             `json:"total_count"`
+	AverageLengthMs float64         `json:"average_length_ms"`
+	Longest         []sectionLength `json:"longest"`
+	Shortest        []sectionLength `json:"shortest"`
+}
+
+type songIDsResponse struct {
+	SongIDs []string `json:"song_ids" example:"4uLU6hMCjMI75M1A2tKUQC"`
+}
+
+type latestSkipChangeResponse struct {
+	ChangedAt *time.Time `json:"changed_at"` // Null when the user has no songs
+}
+
+// Data of a skip_change event sent by skipStream
+type skipStreamEvent struct {
+	SongID    string    `json:"song_id" example:"4uLU6hMCjMI75M1A2tKUQC"`
+	Change    string    `json:"change" enums:"song_added,song_deleted,song_restored,sections_changed"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+type songDetailsBatchResponse struct {
+	Songs map[string]songDetails `json:"songs"`
+}
+
+type deletedCountResponse struct {
+	DeletedCount int64 `json:"deleted_count"`
+}
+
+type validateSectionsResponse struct {
+	Valid  bool           `json:"valid"`
+	Issues []sectionIssue `json:"issues"`
+}
+
+type skipEventResponse struct {
+	SkipEvent skipEvent `json:"skip_event"`
+}
+
+type skipEventListResponse struct {
+	SkipEvents []skipEvent `json:"skip_events"`
+	Limit      int         `json:"limit"`
+	Offset     int         `json:"offset"`
+}
+
+type importResponse struct {
+	SongsImported    int   `json:"songs_imported"`
+	SongsSkipped     int   `json:"songs_skipped"`
+	SectionsImported int64 `json:"sections_imported"`
+}
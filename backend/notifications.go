@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Postgres channel the notify_skip_changes triggers on songs announce changes on
+const skipChangesChannel = "skip_changes"
+
+// How long the listener waits before reconnecting after losing its connection
+const skipChangesRetryDelay = 5 * time.Second
+
+// How often an idle skip stream sends a comment so proxies don't close it
+const skipStreamHeartbeat = 30 * time.Second
+
+// A change to a song or its skipped sections, as announced by Postgres
+type skipChange struct {
+	UserID    string    `json:"user_id"`
+	SongID    string    `json:"song_id"`
+	Change    string    `json:"change"` // song_added, song_deleted, song_restored or sections_changed
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// One user's feed of skip changes. When the subscriber falls behind, changes are dropped
+// and resync is signalled instead, so it knows to reload everything.
+type skipSubscription struct {
+	userID  string
+	changes chan skipChange
+	resync  chan struct{}
+}
+
+// The latest change seen for each user, and everyone waiting for changes
+var skipChanges = struct {
+	sync.Mutex
+	latest      map[string]time.Time
+	subscribers map[*skipSubscription]struct{}
+}{latest: map[string]time.Time{}, subscribers: map[*skipSubscription]struct{}{}}
+
+// Registers for the user's skip changes seen from now on. The returned function
+// unsubscribes and must be called once the caller stops reading.
+func subscribeSkipChanges(userID string) (*skipSubscription, func()) {
+	subscription := &skipSubscription{
+		userID:  userID,
+		changes: make(chan skipChange, 16),
+		resync:  make(chan struct{}, 1),
+	}
+
+	skipChanges.Lock()
+	skipChanges.subscribers[subscription] = struct{}{}
+	skipChanges.Unlock()
+
+	return subscription, func() {
+		skipChanges.Lock()
+		delete(skipChanges.subscribers, subscription)
+		skipChanges.Unlock()
+	}
+}
+
+// Records a change and passes it on to the user's subscribers. A subscriber that has
+// fallen behind is told to resync rather than holding up everyone else.
+func publishSkipChange(change skipChange) {
+	skipChanges.Lock()
+	defer skipChanges.Unlock()
+
+	if change.ChangedAt.After(skipChanges.latest[change.UserID]) {
+		skipChanges.latest[change.UserID] = change.ChangedAt
+	}
+	for subscriber := range skipChanges.subscribers {
+		if subscriber.userID != change.UserID {
+			continue
+		}
+		select {
+		case subscriber.changes <- change:
+		default:
+			select {
+			case subscriber.resync <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// Listens for skip changes until ctx is cancelled, reconnecting whenever the connection drops
+func listenForSkipChanges(ctx context.Context) {
+	for {
+		err := listenOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Error("skip change listener failed, reconnecting", slog.String("error", err.Error()))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(skipChangesRetryDelay):
+		}
+	}
+}
+
+// Publishes the notifications of a listening connection until it fails
+func listenOnce(ctx context.Context) error {
+	return songRepo.ListenSkipChanges(ctx, func(payload string) {
+		var change skipChange
+		if err := json.Unmarshal([]byte(payload), &change); err != nil {
+			slog.Warn("ignoring malformed skip change", slog.String("payload", payload))
+			return
+		}
+		publishSkipChange(change)
+	})
+}
+
+// Reports when the user's skip data last changed, so clients with a cached skip map know
+// whether to refresh it. Changes seen by this server are used first; before any, the
+// time is read from the songs themselves.
+//
+//	@Summary	Get when the user's skip data last changed
+//	@Tags		sections
+//	@Produce	json
+//	@Security	SpotifyToken
+//	@Success	200	{object}	envelope{data=latestSkipChangeResponse}
+//	@Router		/v1/skipChanges/latest [get]
+func getLatestSkipChange(c *gin.Context) {
+	ctx, cancel := queryContext(c)
+	defer cancel()
+
+	userID := currentUserID(c)
+
+	skipChanges.Lock()
+	latest, ok := skipChanges.latest[userID]
+	skipChanges.Unlock()
+
+	var changedAt *time.Time
+	if ok {
+		changedAt = &latest
+	} else {
+		var err error
+		changedAt, err = songRepo.LatestSkipChange(ctx, userID)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to retrieve latest skip change: "+err.Error())
+			return
+		}
+	}
+
+	respond(c, http.StatusOK, "", gin.H{"changed_at": changedAt})
+}
+
+// Streams the user's skip changes as Server-Sent Events until the client goes away. Each
+// change is a skip_change event carrying the song ID and what happened to it; clients
+// should refetch that song's sections, or everything after a reconnect, since changes
+// made while disconnected are not replayed. A client too slow to keep up gets a resync
+// event in place of the changes it missed, and should refetch everything too.
+//
+//	@Summary	Stream changes to the user's skip data
+//	@Tags		sections
+//	@Produce	text/event-stream
+//	@Security	SpotifyToken
+//	@Success	200	{object}	skipStreamEvent	"One skip_change event per change"
+//	@Router		/v1/skipStream [get]
+func skipStream(c *gin.Context) {
+	subscription, unsubscribe := subscribeSkipChanges(currentUserID(c))
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(skipStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	ctx := c.Request.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			if _, err := c.Writer.WriteString(": heartbeat\n\n"); err != nil {
+				return
+			}
+		case change := <-subscription.changes:
+			c.SSEvent("skip_change", skipStreamEvent{SongID: change.SongID, Change: change.Change, ChangedAt: change.ChangedAt})
+		case <-subscription.resync:
+			c.SSEvent("resync", gin.H{})
+		}
+		c.Writer.Flush()
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+// SQL run by pgSongRepository, kept in one place so it can be reviewed together. The pool
+// prepares each statement on first use and caches it per connection (see dbConnection),
+// so repeated queries skip parsing and planning. Queries whose filters or ordering are
+// assembled per request stay next to the code that builds them.
+
+// Songs
+const (
+	getSongQuery            = "SELECT song_id, title, artist, duration, created_at, updated_at FROM songs WHERE song_id = $1 AND user_id = $2 AND deleted_at IS NULL"
+	getSongDetailsQuery     = "SELECT song_id, title, artist, duration FROM songs WHERE song_id = $1 AND user_id = $2 AND deleted_at IS NULL"
+	getSongsDetailsQuery    = "SELECT song_id, title, artist, duration FROM songs WHERE song_id = ANY($1) AND user_id = $2 AND deleted_at IS NULL"
+	songDurationQuery       = "SELECT duration FROM songs WHERE song_id = $1 AND user_id = $2 AND deleted_at IS NULL"
+	songExistsQuery         = "SELECT EXISTS (SELECT 1 FROM songs WHERE song_id = $1 AND user_id = $2 AND deleted_at IS NULL)"
+	lockSongQuery           = "SELECT 1 FROM songs WHERE song_id = $1 AND user_id = $2 AND deleted_at IS NULL FOR UPDATE"
+	lockSongDurationQuery   = "SELECT duration FROM songs WHERE song_id = $1 AND user_id = $2 AND deleted_at IS NULL FOR UPDATE"
+	countSongsQuery         = "SELECT COUNT(*) FROM songs WHERE user_id = $1 AND deleted_at IS NULL"
+	countOtherSongsQuery    = "SELECT COUNT(*) FROM songs WHERE user_id = $1 AND deleted_at IS NULL AND song_id <> $2"
+	insertSongQuery         = "INSERT INTO songs (song_id, user_id, title, artist, duration, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, now(), now())"
+	insertSongIfAbsentQuery = "INSERT INTO songs (song_id, user_id, title, artist, duration) VALUES ($1, $2, $3, $4, $5) ON CONFLICT DO NOTHING"
+	insertSongByIDQuery     = "INSERT INTO songs (song_id, user_id, created_at, updated_at) VALUES ($1, $2, now(), now()) ON CONFLICT DO NOTHING"
+	upsertSongQuery         = `INSERT INTO songs (song_id, user_id, title, artist, duration, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, now(), now())
+		ON CONFLICT (user_id, song_id) DO UPDATE SET
+		title = COALESCE(NULLIF(EXCLUDED.title, ''), songs.title), artist = COALESCE(NULLIF(EXCLUDED.artist, ''), songs.artist),
+		duration = COALESCE(EXCLUDED.duration, songs.duration),
+		deleted_at = NULL, updated_at = now(),
+		skips_updated_at = CASE WHEN songs.deleted_at IS NULL THEN songs.skips_updated_at ELSE now() END
+		RETURNING xmax = 0`
+	replaceSongQuery = `UPDATE songs SET title = $1, artist = $2, duration = $3, updated_at = now()
+		WHERE song_id = $4 AND user_id = $5 AND deleted_at IS NULL AND ($6::timestamptz IS NULL OR updated_at < $6)`
+	patchSongQuery = `UPDATE songs SET title = COALESCE($1, title), artist = COALESCE($2, artist), duration = COALESCE($3, duration), updated_at = now()
+		WHERE song_id = $4 AND user_id = $5 AND deleted_at IS NULL AND ($6::timestamptz IS NULL OR updated_at < $6)`
+	softDeleteSongQuery     = "UPDATE songs SET deleted_at = now(), skips_updated_at = now() WHERE song_id = $1 AND user_id = $2 AND deleted_at IS NULL"
+	softDeleteSongsQuery    = "UPDATE songs SET deleted_at = now(), skips_updated_at = now() WHERE song_id = ANY($1) AND user_id = $2 AND deleted_at IS NULL"
+	restoreSongQuery        = "UPDATE songs SET deleted_at = NULL, skips_updated_at = now() WHERE song_id = $1 AND user_id = $2 AND deleted_at IS NOT NULL"
+	deleteSongQuery         = "DELETE FROM songs WHERE song_id = $1 AND user_id = $2"
+	deleteSongsQuery        = "DELETE FROM songs WHERE song_id = ANY($1) AND user_id = $2"
+	deleteUserSongsQuery    = "DELETE FROM songs WHERE user_id = $1"
+	deleteDeletedSongsQuery = "DELETE FROM songs WHERE user_id = $1 AND song_id = ANY($2) AND deleted_at IS NOT NULL"
+	countSearchSongsQuery   = "SELECT COUNT(*) FROM songs WHERE user_id = $1 AND deleted_at IS NULL AND lookup_key LIKE lower($2)"
+	searchSongsQuery        = "SELECT song_id, title, artist, duration, created_at, updated_at FROM songs WHERE user_id = $1 AND deleted_at IS NULL AND lookup_key LIKE lower($2) ORDER BY title, song_id LIMIT $3 OFFSET $4"
+	duplicateSongQuery      = "SELECT song_id FROM songs WHERE user_id = $1 AND deleted_at IS NULL AND lookup_key = lower($2 || ' - ' || $3) AND song_id <> $4 LIMIT 1"
+	songIDsQuery            = "SELECT song_id FROM songs WHERE user_id = $1 AND deleted_at IS NULL ORDER BY song_id"
+	songIDsWithSkipsQuery   = `SELECT song_id FROM songs s WHERE user_id = $1 AND deleted_at IS NULL
+		AND EXISTS (SELECT 1 FROM skipped_sections ss WHERE ss.user_id = s.user_id AND ss.song_id = s.song_id AND ss.enabled)
+		ORDER BY song_id`
+)
+
+// Skipped sections
+const (
+	songSectionsQuery       = "SELECT id, start_time, end_time, label, enabled, created_at FROM skipped_sections WHERE song_id = $1 AND user_id = $2 ORDER BY order_index NULLS LAST, start_time"
+	getSongsSectionsQuery   = "SELECT song_id, id, start_time, end_time, label, enabled, created_at FROM skipped_sections WHERE song_id = ANY($1) AND user_id = $2 AND (enabled OR $3) ORDER BY song_id, order_index NULLS LAST, start_time"
+	songSectionExistsQuery  = "SELECT EXISTS (SELECT 1 FROM skipped_sections WHERE id = $1 AND song_id = $2 AND user_id = $3)"
+	sectionSongQuery        = "SELECT song_id FROM skipped_sections WHERE id = $1 AND user_id = $2"
+	countSectionsQuery      = "SELECT COUNT(*) FROM skipped_sections WHERE user_id = $1"
+	insertSectionQuery      = "INSERT INTO skipped_sections (song_id, user_id, start_time, end_time, label) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at"
+	updateSectionTimesQuery = "UPDATE skipped_sections SET start_time = $1, end_time = $2 WHERE id = $3 AND user_id = $4"
+	toggleSectionQuery      = "UPDATE skipped_sections SET enabled = NOT enabled WHERE id = $1 AND user_id = $2 RETURNING id, start_time, end_time, label, enabled, created_at"
+	reorderSectionsQuery    = `UPDATE skipped_sections ss SET order_index = o.ord
+		FROM unnest($1::integer[]) WITH ORDINALITY AS o(id, ord)
+		WHERE ss.id = o.id AND ss.song_id = $2 AND ss.user_id = $3`
+	deleteSectionQuery          = "DELETE FROM skipped_sections WHERE id = $1 AND user_id = $2"
+	deleteSongSectionsQuery     = "DELETE FROM skipped_sections WHERE song_id = $1 AND user_id = $2"
+	deleteSongsSectionsQuery    = "DELETE FROM skipped_sections WHERE song_id = ANY($1) AND user_id = $2"
+	deleteOrphanedSectionsQuery = `DELETE FROM skipped_sections ss
+		WHERE NOT EXISTS (SELECT 1 FROM songs s WHERE s.user_id = ss.user_id AND s.song_id = ss.song_id)`
+	exportSectionsQuery = `SELECT s.song_id, s.title, s.artist, s.duration, ss.start_time, ss.end_time, ss.label, ss.enabled
+		FROM songs s
+		LEFT JOIN skipped_sections ss ON ss.user_id = s.user_id AND ss.song_id = s.song_id
+		WHERE s.user_id = $1 AND s.deleted_at IS NULL
+		ORDER BY s.song_id, ss.start_time`
+	skipMapQuery = `SELECT ss.song_id, ss.start_time, ss.end_time
+		FROM skipped_sections ss
+		JOIN songs s ON s.user_id = ss.user_id AND s.song_id = ss.song_id
+		WHERE ss.user_id = $1 AND s.deleted_at IS NULL AND (ss.enabled OR $2)
+		ORDER BY ss.song_id, ss.start_time`
+	skipMapSinceQuery = `SELECT s.song_id, ss.start_time, ss.end_time
+		FROM songs s
+		LEFT JOIN skipped_sections ss ON ss.user_id = s.user_id AND ss.song_id = s.song_id AND s.deleted_at IS NULL AND (ss.enabled OR $3)
+		WHERE s.user_id = $1 AND s.skips_updated_at > $2
+		ORDER BY s.song_id, ss.start_time`
+)
+
+// Skip events
+const (
+	insertSkipEventQuery = "INSERT INTO skip_events (user_id, song_id, section_id, skipped_at) VALUES ($1, $2, $3, COALESCE($4, now())) RETURNING id, skipped_at, created_at"
+	skipEventsQuery      = "SELECT id, song_id, section_id, skipped_at, created_at FROM skip_events WHERE song_id = $1 AND user_id = $2 ORDER BY skipped_at DESC, id DESC LIMIT $3 OFFSET $4"
+	moveSkipEventsQuery  = "UPDATE skip_events SET song_id = $1, section_id = NULL WHERE song_id = $2 AND user_id = $3"
+)
+
+// Statistics and admin listings
+const (
+	statsQuery = `SELECT
+		(SELECT COUNT(*) FROM songs WHERE deleted_at IS NULL),
+		(SELECT COUNT(*) FROM skipped_sections ss JOIN songs s ON s.user_id = ss.user_id AND s.song_id = ss.song_id WHERE s.deleted_at IS NULL)`
+	sectionStatsQuery = `SELECT COUNT(ss.id), COALESCE(AVG(ss.end_time - ss.start_time), 0)
+		FROM skipped_sections ss
+		JOIN songs s ON s.user_id = ss.user_id AND s.song_id = ss.song_id
+		WHERE ss.user_id = $1 AND s.deleted_at IS NULL`
+	longestSectionsQuery = `SELECT ss.id, ss.song_id, ss.start_time, ss.end_time, ss.end_time - ss.start_time, ss.label
+		FROM skipped_sections ss
+		JOIN songs s ON s.user_id = ss.user_id AND s.song_id = ss.song_id
+		WHERE ss.user_id = $1 AND s.deleted_at IS NULL
+		ORDER BY ss.end_time - ss.start_time DESC, ss.id
+		LIMIT $2`
+	shortestSectionsQuery = `SELECT ss.id, ss.song_id, ss.start_time, ss.end_time, ss.end_time - ss.start_time, ss.label
+		FROM skipped_sections ss
+		JOIN songs s ON s.user_id = ss.user_id AND s.song_id = ss.song_id
+		WHERE ss.user_id = $1 AND s.deleted_at IS NULL
+		ORDER BY ss.end_time - ss.start_time ASC, ss.id
+		LIMIT $2`
+	mostSkippedSongsQuery = `SELECT ranked.song_id, own.title, own.artist, ranked.section_count, ranked.total_skipped_ms, ranked.user_count
+		FROM (
+			SELECT s.song_id, COUNT(ss.id) AS section_count, SUM(ss.end_time - ss.start_time) AS total_skipped_ms, COUNT(DISTINCT s.user_id) AS user_count
+			FROM songs s
+			JOIN skipped_sections ss ON ss.user_id = s.user_id AND ss.song_id = s.song_id
+			WHERE s.deleted_at IS NULL
+			GROUP BY s.song_id
+			ORDER BY total_skipped_ms DESC, section_count DESC, s.song_id
+			LIMIT $1
+		) ranked
+		LEFT JOIN songs own ON own.song_id = ranked.song_id AND own.user_id = $2 AND own.deleted_at IS NULL
+		ORDER BY ranked.total_skipped_ms DESC, ranked.section_count DESC, ranked.song_id`
+	countSongsWithoutSkipsQuery = `SELECT COUNT(*) FROM songs s
+		LEFT JOIN skipped_sections ss ON ss.user_id = s.user_id AND ss.song_id = s.song_id
+		WHERE ss.id IS NULL AND s.deleted_at IS NULL`
+	songsWithoutSkipsQuery = `SELECT s.user_id, s.song_id, s.title, s.artist, s.duration, s.created_at, s.updated_at FROM songs s
+		LEFT JOIN skipped_sections ss ON ss.user_id = s.user_id AND ss.song_id = s.song_id
+		WHERE ss.id IS NULL AND s.deleted_at IS NULL
+		ORDER BY s.created_at, s.user_id, s.song_id LIMIT $1 OFFSET $2`
+	latestSkipChangeQuery = "SELECT MAX(skips_updated_at) FROM songs WHERE user_id = $1"
+	serverTimeQuery       = "SELECT now()"
+)
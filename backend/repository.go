@@ -0,0 +1,1333 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Returned by SongRepository when the song doesn't exist for the user, or is deleted
+var errSongNotFound = errors.New("song not found")
+
+// Returned by SongRepository when the skipped section doesn't exist for the user
+var errSectionNotFound = errors.New("skipped section not found")
+
+// Returned by SongRepository.Insert when the user already has the song, even a deleted one
+var errSongExists = errors.New("song already exists")
+
+// Returned by SongRepository when the user would store more than maxSongsPerUser songs
+var errSongQuotaExceeded = errors.New("song quota exceeded")
+
+// Returned by SongRepository.MergeSongs when the song to merge in doesn't exist
+var errMergeSourceNotFound = errors.New("source song not found")
+
+// Returned by SongRepository.ReorderSkippedSections when the order isn't a permutation of
+// the song's sections
+type sectionOrderError struct {
+	message string
+}
+
+func (e *sectionOrderError) Error() string {
+	return e.message
+}
+
+// Returned by SongRepository when a section is invalid on its own or for its song's duration
+type invalidSectionError struct {
+	index int // Position of the section among those sent, or -1 when only one was
+	err   error
+}
+
+func (e *invalidSectionError) Error() string {
+	if e.index < 0 {
+		return "Invalid skipped section: " + e.err.Error()
+	}
+	return fmt.Sprintf("Invalid skipped section at index %d: %v", e.index, e.err)
+}
+
+// Returned by SongRepository.AddSkippedSections when the user would store more than
+// maxSectionsPerUser sections
+var errSectionQuotaExceeded = errors.New("skipped section quota exceeded")
+
+// Returned by SongRepository.AddSkippedSections when two sections, new or stored, overlap
+type sectionOverlapError struct {
+	First, Second skippedSection
+}
+
+func (e *sectionOverlapError) Error() string {
+	return fmt.Sprintf("Skipped sections %s and %s overlap", e.First, e.Second)
+}
+
+// How getSongs pages through a user's songs
+type songListOptions struct {
+	Limit  int
+	Offset int
+	Order  songOrder
+	Artist string      // Case-insensitive partial match; empty matches every song
+	After  *pageCursor // Continue after this song, in Order
+}
+
+// How getSkipMap selects sections
+type skipMapOptions struct {
+	UpdatedSince    *time.Time // Only songs whose sections changed after this, each with its full list
+	Paged           bool       // Page over songs with Limit and Offset, or after After
+	Limit           int
+	Offset          int
+	After           string // Continue after this song ID
+	IncludeDisabled bool
+}
+
+// Sections to add to one song in SongRepository.AddSkippedSectionsBatch
+type songSections struct {
+	SongID   string
+	Sections []sectionInput
+}
+
+// Database access for songs and their skipped sections, so handlers only deal with HTTP
+// and can be tested against a fake. Every method is scoped to one user, except the
+// statistics and admin ones at the end, which span every user.
+type SongRepository interface {
+	// Reports whether the database is reachable
+	Ping(ctx context.Context) error
+
+	// Returns a song that isn't deleted, or errSongNotFound
+	GetByID(ctx context.Context, userID, songID string) (storedSong, error)
+	// Returns a song with all its skipped sections, or errSongNotFound
+	GetDetails(ctx context.Context, userID, songID string) (songDetails, error)
+	// Returns a page of songs and how many songs match in total
+	ListSongs(ctx context.Context, userID string, options songListOptions) ([]songSummary, int, error)
+	// Reports whether a song exists and isn't deleted, for handlers that only need to
+	// validate the song before working on its sections or events
+	Exists(ctx context.Context, userID, songID string) (bool, error)
+	// Returns the ID of another song with the same artist and title, ignoring case, if the
+	// user has one. Songs missing either are never duplicates.
+	FindDuplicate(ctx context.Context, userID, songID, title, artist string) (string, bool, error)
+	// Returns the IDs of all songs, or only of those with an enabled section
+	ListIDs(ctx context.Context, userID string, withSections bool) ([]string, error)
+	// Returns a song's duration, nil when unknown, or errSongNotFound
+	Duration(ctx context.Context, userID, songID string) (*int, error)
+	// Stores sections for a song after merging those within gap of each other, returning the
+	// created ones and the stored copies of sections that already existed. Fails with
+	// errSongNotFound, *invalidSectionError, *sectionOverlapError or errSectionQuotaExceeded
+	// without storing anything.
+	AddSkippedSections(ctx context.Context, userID, songID string, sections []sectionInput, gap int) ([]skippedSection, []skippedSection, error)
+	// Changes the times of a stored section, checking them against the song's duration and
+	// its other sections like AddSkippedSections. Fails with errSectionNotFound,
+	// errSongNotFound, *invalidSectionError or *sectionOverlapError.
+	UpdateSkippedSection(ctx context.Context, userID string, sectionID int, section sectionInput) error
+	// Marks a song deleted so it can be restored, or returns errSongNotFound
+	SoftDelete(ctx context.Context, userID, songID string) error
+	// Removes a song and its sections for good, or returns errSongNotFound
+	HardDelete(ctx context.Context, userID, songID string) error
+	// Brings back a deleted song, or returns errSongNotFound when there is none
+	Restore(ctx context.Context, userID, songID string) error
+	// Soft deletes songs, or removes them and their sections for good when hard, returning
+	// how many were deleted
+	DeleteMany(ctx context.Context, userID string, songIDs []string, hard bool) (int64, error)
+	// Counts the user's songs other than songID, for the song quota
+	CountOtherSongs(ctx context.Context, userID, songID string) (int, error)
+	// Stores a new song, or returns errSongExists
+	Insert(ctx context.Context, userID string, song songRequest) error
+	// Stores a song, or updates and revives the stored one, reporting whether it was created
+	Upsert(ctx context.Context, userID string, song songRequest) (bool, error)
+	// Stores the songs that don't exist yet in one transaction, reporting for each whether
+	// it was created. Fails with errSongQuotaExceeded without storing anything.
+	AddSongs(ctx context.Context, userID string, songs []songRequest) ([]bool, error)
+	// Overwrites a song's fields unless it changed at or after before, when given.
+	// Reports false when no song was updated.
+	Replace(ctx context.Context, userID, songID string, song songReplaceRequest, before *time.Time) (bool, error)
+	// Like Replace, but only changes the fields that are set
+	Patch(ctx context.Context, userID, songID string, song songUpdateRequest, before *time.Time) (bool, error)
+	// Returns the songs among songIDs that exist, keyed by ID, with their skipped sections
+	GetDetailsBatch(ctx context.Context, userID string, songIDs []string, includeDisabled bool) (map[string]*songDetails, error)
+	// Returns a page of songs whose lookup key, "artist - title" in lower case, contains
+	// text, ignoring case, and how many match in total
+	Search(ctx context.Context, userID, text string, limit, offset int) ([]storedSong, int, error)
+	// Calls write with each song and its skipped sections, in song ID order, stopping at
+	// the first error write returns
+	Export(ctx context.Context, userID string, write func(exportedSong) error) error
+	// Stores exported songs in one transaction, leaving songs the user already has as they
+	// are, or first deleting the user's whole library when replace is set. Fails with
+	// errSongQuotaExceeded or errSectionQuotaExceeded without storing anything.
+	Import(ctx context.Context, userID string, songs []exportedSong, replace bool) (importResponse, error)
+
+	// Returns a song's skipped sections in display order, an empty list when it has none
+	SkippedSections(ctx context.Context, userID, songID string) ([]skippedSection, error)
+	// Swaps all sections of a song for new ones, returning them. Fails with
+	// errSectionQuotaExceeded without changing anything.
+	ReplaceSkippedSections(ctx context.Context, userID, songID string, sections []sectionInput) ([]skippedSection, error)
+	// Sets the display order of a song's sections and returns them in it. Fails with
+	// errSongNotFound or *sectionOrderError.
+	ReorderSkippedSections(ctx context.Context, userID, songID string, sectionIDs []int) ([]skippedSection, error)
+	// Removes all sections of a song, returning how many there were
+	ClearSkippedSections(ctx context.Context, userID, songID string) (int64, error)
+	// Moves the source song's sections and skip events to the target, merging overlaps,
+	// deletes the source and returns the target's new sections. Fails with
+	// errSongNotFound or errMergeSourceNotFound.
+	MergeSongs(ctx context.Context, userID, targetID, sourceID string) ([]skippedSection, error)
+	// Adds sections to many songs in one transaction, returning the outcome for each in
+	// order. Missing songs are created by ID when createMissing is set. Fails with
+	// errSongQuotaExceeded or errSectionQuotaExceeded without storing anything.
+	AddSkippedSectionsBatch(ctx context.Context, userID string, songs []songSections, createMissing bool, gap int) ([]songSectionsResult, error)
+	// Enables a disabled section or disables an enabled one, or returns errSectionNotFound
+	ToggleSkippedSection(ctx context.Context, userID string, sectionID int) (skippedSection, error)
+	// Removes one section, or returns errSectionNotFound
+	DeleteSkippedSection(ctx context.Context, userID string, sectionID int) error
+	// Returns section times keyed by song ID, and the database time to send as the next
+	// updated_since
+	SkipMap(ctx context.Context, userID string, options skipMapOptions) (map[string][]sectionInput, time.Time, error)
+	// Summarizes section lengths with the limit longest and shortest sections
+	SectionStats(ctx context.Context, userID string, limit int) (sectionStatsResponse, error)
+
+	// Reports whether a section belongs to the song
+	SectionExists(ctx context.Context, userID, songID string, sectionID int) (bool, error)
+	// Records a skip event, defaulting its time to now
+	AddSkipEvent(ctx context.Context, userID string, request skipEventRequest) (skipEvent, error)
+	// Returns a page of a song's skip events, most recent first
+	ListSkipEvents(ctx context.Context, userID, songID string, limit, offset int) ([]skipEvent, error)
+	// Returns when the user's skip data last changed, nil when it never has
+	LatestSkipChange(ctx context.Context, userID string) (*time.Time, error)
+	// Calls onChange with the payload of every skip change announced by the database
+	// until ctx is cancelled or the connection fails
+	ListenSkipChanges(ctx context.Context, onChange func(payload string)) error
+
+	// Counts the songs and skipped sections of every user, leaving out deleted songs
+	CountAll(ctx context.Context) (int, int, error)
+	// Ranks songs of every user by total skipped time. Titles and artists are userID's own,
+	// nil for songs they don't have.
+	MostSkipped(ctx context.Context, userID string, limit int) ([]mostSkippedSong, error)
+	// Returns a page of every user's songs without skipped sections and how many there are
+	ListSongsWithoutSkips(ctx context.Context, limit, offset int) ([]adminSong, int, error)
+	// Deletes skipped sections whose song no longer exists, returning how many were removed.
+	// The foreign key should prevent these, but rows can still drift in through manual
+	// fixes or restores that bypassed it.
+	DeleteOrphanedSections(ctx context.Context) (int64, error)
+}
+
+// Set up by dbConnection
+var songRepo SongRepository
+
+// SongRepository backed by the Postgres pool
+type pgSongRepository struct {
+	db *pgxpool.Pool
+}
+
+func (r *pgSongRepository) Ping(ctx context.Context) error {
+	return r.db.Ping(ctx)
+}
+
+func (r *pgSongRepository) GetByID(ctx context.Context, userID, songID string) (storedSong, error) {
+	var song storedSong
+	err := r.db.QueryRow(ctx, getSongQuery, songID, userID).
+		Scan(&song.SongID, &song.Title, &song.Artist, &song.Duration, &song.CreatedAt, &song.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return song, errSongNotFound
+	}
+	return song, err
+}
+
+func (r *pgSongRepository) GetDetails(ctx context.Context, userID, songID string) (songDetails, error) {
+	var song songDetails
+	err := r.db.QueryRow(ctx, getSongDetailsQuery, songID, userID).
+		Scan(&song.SongID, &song.Title, &song.Artist, &song.Duration)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return song, errSongNotFound
+	}
+	if err != nil {
+		return song, err
+	}
+
+	song.SkippedSections, err = songSkippedSections(ctx, r.db, userID, songID)
+	if err != nil {
+		return song, fmt.Errorf("retrieve skipped sections: %w", err)
+	}
+	return song, nil
+}
+
+func (r *pgSongRepository) Exists(ctx context.Context, userID, songID string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(ctx, songExistsQuery, songID, userID).Scan(&exists)
+	return exists, err
+}
+
+func (r *pgSongRepository) FindDuplicate(ctx context.Context, userID, songID, title, artist string) (string, bool, error) {
+	if title == "" || artist == "" {
+		return "", false, nil
+	}
+
+	var duplicateID string
+	err := r.db.QueryRow(ctx, duplicateSongQuery, userID, artist, title, songID).Scan(&duplicateID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return duplicateID, true, nil
+}
+
+func (r *pgSongRepository) ListSongs(ctx context.Context, userID string, options songListOptions) ([]songSummary, int, error) {
+	filter := "user_id = $1 AND deleted_at IS NULL"
+	args := []any{userID}
+
+	if options.Artist != "" {
+		args = append(args, "%"+escapeLike(options.Artist)+"%")
+		filter += fmt.Sprintf(" AND artist ILIKE $%d", len(args))
+	}
+
+	// The total covers every page, so it is counted before the cursor narrows the filter
+	var totalCount int
+	if err := r.db.QueryRow(ctx, "SELECT COUNT(*) FROM songs WHERE "+filter, args...).Scan(&totalCount); err != nil {
+		return nil, 0, fmt.Errorf("count songs: %w", err)
+	}
+
+	// A cursor continues right after the last song of the previous page, in the same order
+	if cursor := options.After; cursor != nil {
+		var value any = cursor.Value
+		if cursor.CreatedAt != nil {
+			value = *cursor.CreatedAt
+		}
+		comparison := ">"
+		if options.Order.descending {
+			comparison = "<"
+		}
+		args = append(args, value, cursor.SongID)
+		filter += fmt.Sprintf(" AND (%s %s $%d OR (%s = $%d AND song_id > $%d))",
+			options.Order.column, comparison, len(args)-1, options.Order.column, len(args)-1, len(args))
+	}
+
+	// Count each song's sections alongside it so list views need no extra calls
+	rows, err := r.db.Query(ctx,
+		fmt.Sprintf(`SELECT song_id, title, artist, duration, created_at, updated_at,
+			(SELECT COUNT(*) FROM skipped_sections ss WHERE ss.user_id = songs.user_id AND ss.song_id = songs.song_id)
+		FROM songs WHERE %s ORDER BY %s LIMIT $%d OFFSET $%d`, filter, options.Order, len(args)+1, len(args)+2),
+		append(args, options.Limit, options.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	songs := []songSummary{}
+	for rows.Next() {
+		var song songSummary
+		if err := rows.Scan(&song.SongID, &song.Title, &song.Artist, &song.Duration, &song.CreatedAt, &song.UpdatedAt, &song.SkipCount); err != nil {
+			return nil, 0, err
+		}
+		songs = append(songs, song)
+	}
+	return songs, totalCount, rows.Err()
+}
+
+func (r *pgSongRepository) ListIDs(ctx context.Context, userID string, withSections bool) ([]string, error) {
+	query := songIDsQuery
+	if withSections {
+		query = songIDsWithSkipsQuery
+	}
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	songIDs := []string{}
+	for rows.Next() {
+		var songID string
+		if err := rows.Scan(&songID); err != nil {
+			return nil, err
+		}
+		songIDs = append(songIDs, songID)
+	}
+	return songIDs, rows.Err()
+}
+
+func (r *pgSongRepository) Duration(ctx context.Context, userID, songID string) (*int, error) {
+	var duration *int
+	err := r.db.QueryRow(ctx, songDurationQuery, songID, userID).Scan(&duration)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errSongNotFound
+	}
+	return duration, err
+}
+
+func (r *pgSongRepository) AddSkippedSections(ctx context.Context, userID, songID string, sections []sectionInput, gap int) ([]skippedSection, []skippedSection, error) {
+	// Insert all sections in one transaction so a failure leaves nothing half-written
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the song so concurrent adds are checked for overlaps and the quota one at a time
+	var duration *int
+	err = tx.QueryRow(ctx, lockSongDurationQuery, songID, userID).Scan(&duration)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, errSongNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("check if song exists: %w", err)
+	}
+
+	// Validate every section up front so one bad section rejects the whole batch,
+	// including keeping sections within the track when its duration is known
+	for i, section := range sections {
+		if err := validateSectionInput(section, duration); err != nil {
+			return nil, nil, &invalidSectionError{index: i, err: err}
+		}
+	}
+
+	// Drop repeated sections, then coalesce touching or nearly touching ones before comparing against stored ones
+	sections = mergeSections(dedupeSections(sections), gap)
+
+	existing, err := songSkippedSections(ctx, tx, userID, songID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("retrieve existing skipped sections: %w", err)
+	}
+
+	// Sections identical to stored ones are reported back instead of inserted again
+	sections, alreadyExisted := splitExistingSections(sections, existing)
+
+	// Reject the batch if any two sections, new or already stored, overlap
+	if first, second, found := findOverlap(append(existing, inputSections(sections)...)); found {
+		return nil, nil, &sectionOverlapError{First: first, Second: second}
+	}
+
+	created, err := insertSkippedSections(ctx, tx, userID, songID, sections)
+	if err != nil {
+		return nil, nil, fmt.Errorf("insert skipped sections (%d of %d inserted before failure, all rolled back): %w", len(created), len(sections), err)
+	}
+
+	// Counted after inserting so sections merged or replaced in this request are accounted for
+	exceeded, err := sectionQuotaExceeded(ctx, tx, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("check skipped section quota: %w", err)
+	}
+	if exceeded {
+		return nil, nil, errSectionQuotaExceeded
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, fmt.Errorf("commit skipped sections (expected %d, none saved): %w", len(sections), err)
+	}
+	return created, alreadyExisted, nil
+}
+
+func (r *pgSongRepository) UpdateSkippedSection(ctx context.Context, userID string, sectionID int, section sectionInput) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var songID string
+	err = tx.QueryRow(ctx, sectionSongQuery, sectionID, userID).Scan(&songID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errSectionNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	// Lock the song so a concurrent edit can't slip an overlapping section in
+	var duration *int
+	err = tx.QueryRow(ctx, lockSongDurationQuery, songID, userID).Scan(&duration)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errSongNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := validateSectionInput(section, duration); err != nil {
+		return &invalidSectionError{index: -1, err: err}
+	}
+
+	stored, err := songSkippedSections(ctx, tx, userID, songID)
+	if err != nil {
+		return fmt.Errorf("retrieve skipped sections: %w", err)
+	}
+	sections := []skippedSection{{ID: sectionID, StartTime: section.StartTime, EndTime: section.EndTime}}
+	for _, other := range stored {
+		if other.ID != sectionID {
+			sections = append(sections, other)
+		}
+	}
+	if first, second, found := findOverlap(sections); found {
+		return &sectionOverlapError{First: first, Second: second}
+	}
+
+	if _, err := tx.Exec(ctx, updateSectionTimesQuery, section.StartTime, section.EndTime, sectionID, userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit skipped section: %w", err)
+	}
+	return nil
+}
+
+func (r *pgSongRepository) SoftDelete(ctx context.Context, userID, songID string) error {
+	tag, err := r.db.Exec(ctx, softDeleteSongQuery, songID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errSongNotFound
+	}
+	return nil
+}
+
+func (r *pgSongRepository) HardDelete(ctx context.Context, userID, songID string) error {
+	// Delete the song and its skipped sections together so nothing is left orphaned
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, deleteSongSectionsQuery, songID, userID); err != nil {
+		return fmt.Errorf("delete skipped sections: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, deleteSongQuery, songID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errSongNotFound
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit song deletion: %w", err)
+	}
+	return nil
+}
+
+func (r *pgSongRepository) Restore(ctx context.Context, userID, songID string) error {
+	tag, err := r.db.Exec(ctx, restoreSongQuery, songID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errSongNotFound
+	}
+	return nil
+}
+
+func (r *pgSongRepository) CountOtherSongs(ctx context.Context, userID, songID string) (int, error) {
+	var count int
+	err := r.db.QueryRow(ctx, countOtherSongsQuery, userID, songID).Scan(&count)
+	return count, err
+}
+
+func (r *pgSongRepository) Insert(ctx context.Context, userID string, song songRequest) error {
+	_, err := r.db.Exec(ctx, insertSongQuery, song.SongID, userID, song.Title, song.Artist, song.Duration)
+	if isUniqueViolation(err) {
+		return errSongExists
+	}
+	return err
+}
+
+func (r *pgSongRepository) Upsert(ctx context.Context, userID string, song songRequest) (bool, error) {
+	var created bool
+	err := r.db.QueryRow(ctx, upsertSongQuery, song.SongID, userID, song.Title, song.Artist, song.Duration).Scan(&created)
+	return created, err
+}
+
+func (r *pgSongRepository) AddSongs(ctx context.Context, userID string, songs []songRequest) ([]bool, error) {
+	batch := &pgx.Batch{}
+	for _, song := range songs {
+		batch.Queue(insertSongIfAbsentQuery, song.SongID, userID, song.Title, song.Artist, song.Duration)
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	created := make([]bool, len(songs))
+	batchResults := tx.SendBatch(ctx, batch)
+	for i := range songs {
+		tag, err := batchResults.Exec()
+		if err != nil {
+			batchResults.Close()
+			return nil, fmt.Errorf("insert song at index %d, no songs were added: %w", i, err)
+		}
+		// ON CONFLICT DO NOTHING leaves existing songs untouched and reports no affected rows
+		created[i] = tag.RowsAffected() > 0
+	}
+	if err := batchResults.Close(); err != nil {
+		return nil, fmt.Errorf("insert songs: %w", err)
+	}
+
+	// Counted after inserting so duplicates in the batch don't count twice; rolled back when over
+	var songCount int
+	if err := tx.QueryRow(ctx, countSongsQuery, userID).Scan(&songCount); err != nil {
+		return nil, fmt.Errorf("check song quota: %w", err)
+	}
+	if songCount > maxSongsPerUser {
+		return nil, errSongQuotaExceeded
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit songs: %w", err)
+	}
+	return created, nil
+}
+
+func (r *pgSongRepository) Replace(ctx context.Context, userID, songID string, song songReplaceRequest, before *time.Time) (bool, error) {
+	tag, err := r.db.Exec(ctx, replaceSongQuery, *song.Title, *song.Artist, song.Duration, songID, userID, before)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *pgSongRepository) Patch(ctx context.Context, userID, songID string, song songUpdateRequest, before *time.Time) (bool, error) {
+	tag, err := r.db.Exec(ctx, patchSongQuery, song.Title, song.Artist, song.Duration, songID, userID, before)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *pgSongRepository) DeleteMany(ctx context.Context, userID string, songIDs []string, hard bool) (int64, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var tag pgconn.CommandTag
+	if hard {
+		if _, err := tx.Exec(ctx, deleteSongsSectionsQuery, songIDs, userID); err != nil {
+			return 0, fmt.Errorf("delete skipped sections: %w", err)
+		}
+		tag, err = tx.Exec(ctx, deleteSongsQuery, songIDs, userID)
+	} else {
+		tag, err = tx.Exec(ctx, softDeleteSongsQuery, songIDs, userID)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("commit song deletion: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (r *pgSongRepository) GetDetailsBatch(ctx context.Context, userID string, songIDs []string, includeDisabled bool) (map[string]*songDetails, error) {
+	songs := map[string]*songDetails{}
+
+	rows, err := r.db.Query(ctx, getSongsDetailsQuery, songIDs, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		song := songDetails{SkippedSections: []skippedSection{}}
+		if err := rows.Scan(&song.SongID, &song.Title, &song.Artist, &song.Duration); err != nil {
+			return nil, err
+		}
+		songs[song.SongID] = &song
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sectionRows, err := r.db.Query(ctx, getSongsSectionsQuery, songIDs, userID, includeDisabled)
+	if err != nil {
+		return nil, fmt.Errorf("retrieve skipped sections: %w", err)
+	}
+	defer sectionRows.Close()
+
+	for sectionRows.Next() {
+		var songID string
+		var section skippedSection
+		if err := sectionRows.Scan(&songID, &section.ID, &section.StartTime, &section.EndTime, &section.Label, &section.Enabled, &section.CreatedAt); err != nil {
+			return nil, fmt.Errorf("retrieve skipped sections: %w", err)
+		}
+		// Sections of deleted songs have no entry to attach to
+		if song, ok := songs[songID]; ok {
+			song.SkippedSections = append(song.SkippedSections, section)
+		}
+	}
+	if err := sectionRows.Err(); err != nil {
+		return nil, fmt.Errorf("retrieve skipped sections: %w", err)
+	}
+	return songs, nil
+}
+
+func (r *pgSongRepository) Search(ctx context.Context, userID, text string, limit, offset int) ([]storedSong, int, error) {
+	pattern := "%" + escapeLike(text) + "%"
+
+	var totalCount int
+	if err := r.db.QueryRow(ctx, countSearchSongsQuery, userID, pattern).Scan(&totalCount); err != nil {
+		return nil, 0, fmt.Errorf("count songs: %w", err)
+	}
+
+	rows, err := r.db.Query(ctx, searchSongsQuery, userID, pattern, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	songs := []storedSong{}
+	for rows.Next() {
+		var song storedSong
+		if err := rows.Scan(&song.SongID, &song.Title, &song.Artist, &song.Duration, &song.CreatedAt, &song.UpdatedAt); err != nil {
+			return nil, 0, err
+		}
+		songs = append(songs, song)
+	}
+	return songs, totalCount, rows.Err()
+}
+
+func (r *pgSongRepository) Export(ctx context.Context, userID string, write func(exportedSong) error) error {
+	rows, err := r.db.Query(ctx, exportSectionsQuery, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// Rows arrive grouped by song; each song is written once its last section has been read
+	var current *exportedSong
+	for rows.Next() {
+		var song exportedSong
+		var startTime, endTime *int
+		var label *string
+		var enabled *bool
+		if err := rows.Scan(&song.SongID, &song.Title, &song.Artist, &song.Duration, &startTime, &endTime, &label, &enabled); err != nil {
+			return err
+		}
+
+		if current == nil || current.SongID != song.SongID {
+			if current != nil {
+				if err := write(*current); err != nil {
+					return err
+				}
+			}
+			song.SkippedSections = []exportedSection{}
+			current = &song
+		}
+		if startTime != nil && endTime != nil {
+			current.SkippedSections = append(current.SkippedSections, exportedSection{
+				sectionInput: sectionInput{StartTime: *startTime, EndTime: *endTime, Label: label},
+				Enabled:      enabled,
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if current != nil {
+		return write(*current)
+	}
+	return nil
+}
+
+func (r *pgSongRepository) Import(ctx context.Context, userID string, songs []exportedSong, replace bool) (importResponse, error) {
+	var result importResponse
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return result, fmt.Errorf("start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Replacing starts from an empty library. Merging only clears out deleted copies of
+	// imported songs, so they come back with the imported sections rather than their old ones.
+	if replace {
+		_, err = tx.Exec(ctx, deleteUserSongsQuery, userID)
+	} else {
+		songIDs := make([]string, len(songs))
+		for i, song := range songs {
+			songIDs[i] = song.SongID
+		}
+		_, err = tx.Exec(ctx, deleteDeletedSongsQuery, userID, songIDs)
+	}
+	if err != nil {
+		return result, fmt.Errorf("prepare import: %w", err)
+	}
+
+	var sectionRows [][]any
+	for _, song := range songs {
+		tag, err := tx.Exec(ctx, insertSongIfAbsentQuery, song.SongID, userID, song.Title, song.Artist, song.Duration)
+		if err != nil {
+			return result, fmt.Errorf("import song %s: %w", song.SongID, err)
+		}
+		if tag.RowsAffected() == 0 {
+			result.SongsSkipped++
+			continue
+		}
+		result.SongsImported++
+
+		for _, section := range song.SkippedSections {
+			enabled := section.Enabled == nil || *section.Enabled
+			sectionRows = append(sectionRows, []any{userID, song.SongID, section.StartTime, section.EndTime, section.Label, enabled})
+		}
+	}
+
+	result.SectionsImported, err = tx.CopyFrom(ctx, pgx.Identifier{"skipped_sections"},
+		[]string{"user_id", "song_id", "start_time", "end_time", "label", "enabled"}, pgx.CopyFromRows(sectionRows))
+	if err != nil {
+		return result, fmt.Errorf("import skipped sections: %w", err)
+	}
+
+	var songCount int
+	if err := tx.QueryRow(ctx, countSongsQuery, userID).Scan(&songCount); err != nil {
+		return result, fmt.Errorf("check song quota: %w", err)
+	}
+	if songCount > maxSongsPerUser {
+		return result, errSongQuotaExceeded
+	}
+	exceeded, err := sectionQuotaExceeded(ctx, tx, userID)
+	if err != nil {
+		return result, fmt.Errorf("check skipped section quota: %w", err)
+	}
+	if exceeded {
+		return result, errSectionQuotaExceeded
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return result, fmt.Errorf("commit import: %w", err)
+	}
+	return result, nil
+}
+
+func (r *pgSongRepository) SkippedSections(ctx context.Context, userID, songID string) ([]skippedSection, error) {
+	return songSkippedSections(ctx, r.db, userID, songID)
+}
+
+func (r *pgSongRepository) ReplaceSkippedSections(ctx context.Context, userID, songID string, sections []sectionInput) ([]skippedSection, error) {
+	// Swap the old list for the new one atomically
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, deleteSongSectionsQuery, songID, userID); err != nil {
+		return nil, fmt.Errorf("delete skipped sections: %w", err)
+	}
+
+	created, err := insertSkippedSections(ctx, tx, userID, songID, sections)
+	if err != nil {
+		return nil, fmt.Errorf("insert skipped sections, nothing was changed: %w", err)
+	}
+
+	// Counted after inserting so sections merged or replaced in this request are accounted for
+	exceeded, err := sectionQuotaExceeded(ctx, tx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("check skipped section quota: %w", err)
+	}
+	if exceeded {
+		return nil, errSectionQuotaExceeded
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit skipped sections: %w", err)
+	}
+	return created, nil
+}
+
+func (r *pgSongRepository) ReorderSkippedSections(ctx context.Context, userID, songID string, sectionIDs []int) ([]skippedSection, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the song so sections can't be added or removed while the order is checked
+	var locked int
+	err = tx.QueryRow(ctx, lockSongQuery, songID, userID).Scan(&locked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errSongNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sections, err := songSkippedSections(ctx, tx, userID, songID)
+	if err != nil {
+		return nil, fmt.Errorf("retrieve skipped sections: %w", err)
+	}
+
+	// The new order has to be a permutation of the stored sections
+	stored := make(map[int]bool, len(sections))
+	for _, section := range sections {
+		stored[section.ID] = true
+	}
+	for _, id := range sectionIDs {
+		if !stored[id] {
+			return nil, &sectionOrderError{fmt.Sprintf("Skipped section %d is not a section of this song or is listed twice", id)}
+		}
+		delete(stored, id)
+	}
+	if len(stored) > 0 {
+		return nil, &sectionOrderError{fmt.Sprintf("Every skipped section of the song must be listed, %d are missing", len(stored))}
+	}
+
+	if _, err := tx.Exec(ctx, reorderSectionsQuery, sectionIDs, songID, userID); err != nil {
+		return nil, err
+	}
+
+	sections, err = songSkippedSections(ctx, tx, userID, songID)
+	if err != nil {
+		return nil, fmt.Errorf("retrieve skipped sections: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit new order: %w", err)
+	}
+	return sections, nil
+}
+
+func (r *pgSongRepository) ClearSkippedSections(ctx context.Context, userID, songID string) (int64, error) {
+	tag, err := r.db.Exec(ctx, deleteSongSectionsQuery, songID, userID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (r *pgSongRepository) MergeSongs(ctx context.Context, userID, targetID, sourceID string) ([]skippedSection, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock both songs so concurrent changes to either can't be lost in the merge
+	var locked int
+	err = tx.QueryRow(ctx, lockSongQuery, targetID, userID).Scan(&locked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errSongNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(ctx, lockSongQuery, sourceID, userID).Scan(&locked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errMergeSourceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	targetSections, err := songSkippedSections(ctx, tx, userID, targetID)
+	if err != nil {
+		return nil, fmt.Errorf("retrieve skipped sections: %w", err)
+	}
+	sourceSections, err := songSkippedSections(ctx, tx, userID, sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("retrieve skipped sections: %w", err)
+	}
+
+	// The target's sections come first so their labels win when sections are merged.
+	// Overlaps are always merged, even when MERGE_GAP disables merging nearby sections,
+	// and the merged sections are all stored enabled.
+	sections := make([]sectionInput, 0, len(targetSections)+len(sourceSections))
+	for _, section := range slices.Concat(targetSections, sourceSections) {
+		sections = append(sections, sectionInput{StartTime: section.StartTime, EndTime: section.EndTime, Label: section.Label})
+	}
+	sections = mergeSections(dedupeSections(sections), max(defaultMergeGap, 0))
+
+	// Skip events keep their song but lose their section, since the sections are rewritten below
+	if _, err := tx.Exec(ctx, moveSkipEventsQuery, targetID, sourceID, userID); err != nil {
+		return nil, fmt.Errorf("move skip events: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, deleteSongsSectionsQuery, []string{targetID, sourceID}, userID); err != nil {
+		return nil, fmt.Errorf("delete skipped sections: %w", err)
+	}
+
+	created, err := insertSkippedSections(ctx, tx, userID, targetID, sections)
+	if err != nil {
+		return nil, fmt.Errorf("insert skipped sections, nothing was changed: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, deleteSongQuery, sourceID, userID); err != nil {
+		return nil, fmt.Errorf("delete song: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit merge: %w", err)
+	}
+	return created, nil
+}
+
+func (r *pgSongRepository) AddSkippedSectionsBatch(ctx context.Context, userID string, songs []songSections, createMissing bool, gap int) ([]songSectionsResult, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var songCount int
+	if createMissing {
+		if err := tx.QueryRow(ctx, countSongsQuery, userID).Scan(&songCount); err != nil {
+			return nil, fmt.Errorf("check song quota: %w", err)
+		}
+	}
+
+	results := make([]songSectionsResult, 0, len(songs))
+	for _, song := range songs {
+		songID, sections := song.SongID, song.Sections
+		result := songSectionsResult{SongID: songID, SkippedSections: []skippedSection{}, AlreadyExisted: []skippedSection{}}
+
+		var duration *int
+		err = tx.QueryRow(ctx, lockSongDurationQuery, songID, userID).
+			Scan(&duration)
+		if errors.Is(err, pgx.ErrNoRows) && createMissing {
+			if songCount >= maxSongsPerUser {
+				return nil, errSongQuotaExceeded
+			}
+			// A deleted copy of the song stays deleted; it has to be restored first
+			var tag pgconn.CommandTag
+			tag, err = tx.Exec(ctx, insertSongByIDQuery, songID, userID)
+			if err == nil && tag.RowsAffected() == 0 {
+				err = pgx.ErrNoRows
+			}
+			if err == nil {
+				songCount++
+				result.SongCreated = true
+			}
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			result.Status, result.Error = "not_found", "Song not found"
+			results = append(results, result)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("check if song %s exists: %w", songID, err)
+		}
+
+		if err := validateSectionInputs(sections, duration); err != nil {
+			result.Status, result.Error = "invalid", err.Error()
+			results = append(results, result)
+			continue
+		}
+		sections = mergeSections(dedupeSections(sections), gap)
+
+		existing, err := songSkippedSections(ctx, tx, userID, songID)
+		if err != nil {
+			return nil, fmt.Errorf("retrieve existing skipped sections: %w", err)
+		}
+		sections, result.AlreadyExisted = splitExistingSections(sections, existing)
+
+		if first, second, found := findOverlap(append(existing, inputSections(sections)...)); found {
+			result.Status, result.Error = "invalid", (&sectionOverlapError{First: first, Second: second}).Error()
+			results = append(results, result)
+			continue
+		}
+
+		result.SkippedSections, err = insertSkippedSections(ctx, tx, userID, songID, sections)
+		if err != nil {
+			return nil, fmt.Errorf("insert skipped sections of %s, all rolled back: %w", songID, err)
+		}
+		result.Status = "added"
+		results = append(results, result)
+	}
+
+	exceeded, err := sectionQuotaExceeded(ctx, tx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("check skipped section quota: %w", err)
+	}
+	if exceeded {
+		return nil, errSectionQuotaExceeded
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit skipped sections, none saved: %w", err)
+	}
+	return results, nil
+}
+
+func (r *pgSongRepository) ToggleSkippedSection(ctx context.Context, userID string, sectionID int) (skippedSection, error) {
+	var section skippedSection
+	err := r.db.QueryRow(ctx, toggleSectionQuery, sectionID, userID).
+		Scan(&section.ID, &section.StartTime, &section.EndTime, &section.Label, &section.Enabled, &section.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return section, errSectionNotFound
+	}
+	return section, err
+}
+
+func (r *pgSongRepository) DeleteSkippedSection(ctx context.Context, userID string, sectionID int) error {
+	tag, err := r.db.Exec(ctx, deleteSectionQuery, sectionID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errSectionNotFound
+	}
+	return nil
+}
+
+func (r *pgSongRepository) SkipMap(ctx context.Context, userID string, options skipMapOptions) (map[string][]sectionInput, time.Time, error) {
+	// Taken from the database clock so it lines up with skips_updated_at for the next delta request
+	var serverTime time.Time
+	if err := r.db.QueryRow(ctx, serverTimeQuery).Scan(&serverTime); err != nil {
+		return nil, serverTime, fmt.Errorf("read server time: %w", err)
+	}
+
+	// Disabled sections are left out unless asked for
+	var rows pgx.Rows
+	var err error
+	if options.Paged {
+		// Page over songs rather than sections so each song's sections arrive together.
+		// Songs without sections are listed with an empty list to keep pages aligned.
+		filter := "user_id = $1 AND deleted_at IS NULL"
+		args := []any{userID, options.IncludeDisabled}
+		if options.UpdatedSince != nil {
+			args = append(args, *options.UpdatedSince)
+			filter = fmt.Sprintf("user_id = $1 AND skips_updated_at > $%d", len(args))
+		}
+		if options.After != "" {
+			args = append(args, options.After)
+			filter += fmt.Sprintf(" AND song_id > $%d", len(args))
+		}
+
+		rows, err = r.db.Query(ctx,
+			fmt.Sprintf(`SELECT s.song_id, ss.start_time, ss.end_time
+			FROM (SELECT user_id, song_id, deleted_at FROM songs WHERE %s ORDER BY song_id LIMIT $%d OFFSET $%d) s
+			LEFT JOIN skipped_sections ss ON ss.user_id = s.user_id AND ss.song_id = s.song_id AND s.deleted_at IS NULL AND (ss.enabled OR $2)
+			ORDER BY s.song_id, ss.start_time`, filter, len(args)+1, len(args)+2),
+			append(args, options.Limit, options.Offset)...)
+	} else if options.UpdatedSince == nil {
+		rows, err = r.db.Query(ctx, skipMapQuery, userID, options.IncludeDisabled)
+	} else {
+		rows, err = r.db.Query(ctx, skipMapSinceQuery, userID, *options.UpdatedSince, options.IncludeDisabled)
+	}
+	if err != nil {
+		return nil, serverTime, err
+	}
+	defer rows.Close()
+
+	skipMap := map[string][]sectionInput{}
+	for rows.Next() {
+		var songID string
+		var startTime, endTime *int
+		if err := rows.Scan(&songID, &startTime, &endTime); err != nil {
+			return nil, serverTime, err
+		}
+		if _, ok := skipMap[songID]; !ok {
+			skipMap[songID] = []sectionInput{}
+		}
+		// Songs without sections only appear in delta responses, with no section columns
+		if startTime != nil && endTime != nil {
+			skipMap[songID] = append(skipMap[songID], sectionInput{StartTime: *startTime, EndTime: *endTime})
+		}
+	}
+	return skipMap, serverTime, rows.Err()
+}
+
+func (r *pgSongRepository) SectionStats(ctx context.Context, userID string, limit int) (sectionStatsResponse, error) {
+	var stats sectionStatsResponse
+	err := r.db.QueryRow(ctx, sectionStatsQuery, userID).
+		Scan(&stats.TotalCount, &stats.AverageLengthMs)
+	if err != nil {
+		return stats, err
+	}
+
+	stats.Longest, err = r.sectionLengths(ctx, longestSectionsQuery, userID, limit)
+	if err != nil {
+		return stats, fmt.Errorf("retrieve longest sections: %w", err)
+	}
+	stats.Shortest, err = r.sectionLengths(ctx, shortestSectionsQuery, userID, limit)
+	if err != nil {
+		return stats, fmt.Errorf("retrieve shortest sections: %w", err)
+	}
+	return stats, nil
+}
+
+// Lists the user's skipped sections with longestSectionsQuery or shortestSectionsQuery
+func (r *pgSongRepository) sectionLengths(ctx context.Context, query, userID string, limit int) ([]sectionLength, error) {
+	rows, err := r.db.Query(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sections := []sectionLength{}
+	for rows.Next() {
+		var section sectionLength
+		if err := rows.Scan(&section.ID, &section.SongID, &section.StartTime, &section.EndTime, &section.LengthMs, &section.Label); err != nil {
+			return nil, err
+		}
+		sections = append(sections, section)
+	}
+	return sections, rows.Err()
+}
+
+func (r *pgSongRepository) SectionExists(ctx context.Context, userID, songID string, sectionID int) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(ctx, songSectionExistsQuery, sectionID, songID, userID).Scan(&exists)
+	return exists, err
+}
+
+func (r *pgSongRepository) AddSkipEvent(ctx context.Context, userID string, request skipEventRequest) (skipEvent, error) {
+	event := skipEvent{SongID: request.SongID, SectionID: request.SectionID}
+	err := r.db.QueryRow(ctx, insertSkipEventQuery, userID, request.SongID, request.SectionID, request.SkippedAt).
+		Scan(&event.ID, &event.SkippedAt, &event.CreatedAt)
+	return event, err
+}
+
+func (r *pgSongRepository) ListSkipEvents(ctx context.Context, userID, songID string, limit, offset int) ([]skipEvent, error) {
+	rows, err := r.db.Query(ctx, skipEventsQuery, songID, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []skipEvent{}
+	for rows.Next() {
+		var event skipEvent
+		if err := rows.Scan(&event.ID, &event.SongID, &event.SectionID, &event.SkippedAt, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (r *pgSongRepository) LatestSkipChange(ctx context.Context, userID string) (*time.Time, error) {
+	var changedAt *time.Time
+	err := r.db.QueryRow(ctx, latestSkipChangeQuery, userID).Scan(&changedAt)
+	return changedAt, err
+}
+
+func (r *pgSongRepository) ListenSkipChanges(ctx context.Context, onChange func(payload string)) error {
+	pooled, err := r.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// A listening connection can't go back to the pool, so take it out for good
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{skipChangesChannel}.Sanitize()); err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		onChange(notification.Payload)
+	}
+}
+
+func (r *pgSongRepository) CountAll(ctx context.Context) (int, int, error) {
+	var songs, sections int
+	err := r.db.QueryRow(ctx, statsQuery).Scan(&songs, &sections)
+	return songs, sections, err
+}
+
+func (r *pgSongRepository) MostSkipped(ctx context.Context, userID string, limit int) ([]mostSkippedSong, error) {
+	rows, err := r.db.Query(ctx, mostSkippedSongsQuery, limit, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	songs := []mostSkippedSong{}
+	for rows.Next() {
+		var song mostSkippedSong
+		if err := rows.Scan(&song.SongID, &song.Title, &song.Artist, &song.SectionCount, &song.TotalSkippedMs, &song.UserCount); err != nil {
+			return nil, err
+		}
+		song.TotalSkippedSeconds = song.TotalSkippedMs / 1000
+		songs = append(songs, song)
+	}
+	return songs, rows.Err()
+}
+
+func (r *pgSongRepository) ListSongsWithoutSkips(ctx context.Context, limit, offset int) ([]adminSong, int, error) {
+	var totalCount int
+	if err := r.db.QueryRow(ctx, countSongsWithoutSkipsQuery).Scan(&totalCount); err != nil {
+		return nil, 0, fmt.Errorf("count songs: %w", err)
+	}
+
+	rows, err := r.db.Query(ctx, songsWithoutSkipsQuery, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	songs := []adminSong{}
+	for rows.Next() {
+		var song adminSong
+		if err := rows.Scan(&song.UserID, &song.SongID, &song.Title, &song.Artist, &song.Duration, &song.CreatedAt, &song.UpdatedAt); err != nil {
+			return nil, 0, err
+		}
+		songs = append(songs, song)
+	}
+	return songs, totalCount, rows.Err()
+}
+
+func (r *pgSongRepository) DeleteOrphanedSections(ctx context.Context) (int64, error) {
+	tag, err := r.db.Exec(ctx, deleteOrphanedSectionsQuery)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Reports whether the user now stores more skipped sections than allowed. Meant to run
+// in the transaction that added sections, so they can be rolled back.
+func sectionQuotaExceeded(ctx context.Context, tx pgx.Tx, userID string) (bool, error) {
+	var count int
+	err := tx.QueryRow(ctx, countSectionsQuery, userID).Scan(&count)
+	return count > maxSectionsPerUser, err
+}
+
+// Inserts sections for a song within tx, returning the sections created before any failure
+func insertSkippedSections(ctx context.Context, tx pgx.Tx, userID, songID string, sections []sectionInput) ([]skippedSection, error) {
+	created := make([]skippedSection, 0, len(sections))
+	for _, section := range sections {
+		createdSection := skippedSection{StartTime: section.StartTime, EndTime: section.EndTime, Label: section.Label, Enabled: true}
+		err := tx.QueryRow(ctx, insertSectionQuery, songID, userID, section.StartTime, section.EndTime, section.Label).
+			Scan(&createdSection.ID, &createdSection.CreatedAt)
+
+		if err != nil {
+			return created, err
+		}
+		created = append(created, createdSection)
+	}
+	return created, nil
+}
+
+// Anything that can run a query, such as the pool or a transaction
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// Loads the stored skipped sections for one of the user's songs, in display order
+func songSkippedSections(ctx context.Context, q querier, userID, songID string) ([]skippedSection, error) {
+	rows, err := q.Query(ctx, songSectionsQuery, songID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// A song without sections is not an error; it has an empty list
+	sections := []skippedSection{}
+	for rows.Next() {
+		var section skippedSection
+		if err := rows.Scan(&section.ID, &section.StartTime, &section.EndTime, &section.Label, &section.Enabled, &section.CreatedAt); err != nil {
+			return nil, err
+		}
+		sections = append(sections, section)
+	}
+	return sections, rows.Err()
+}
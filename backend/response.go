@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Every JSON response is wrapped in one of two envelopes so clients can handle them the
+// same way: {"message": ..., "data": ...} on success and
+// {"error": {"code": ..., "message": ...}} on failure.
+
+// Machine-readable error code; clients branch on it instead of the message, which may change
+type errorCode string
+
+// Generic codes, one per error status the API returns
+const (
+	codeBadRequest           errorCode = "BAD_REQUEST"
+	codeUnauthorized         errorCode = "UNAUTHORIZED"
+	codeForbidden            errorCode = "FORBIDDEN"
+	codeNotFound             errorCode = "NOT_FOUND"
+	codeMethodNotAllowed     errorCode = "METHOD_NOT_ALLOWED"
+	codeNotAcceptable        errorCode = "NOT_ACCEPTABLE"
+	codeConflict             errorCode = "CONFLICT"
+	codePreconditionFailed   errorCode = "PRECONDITION_FAILED"
+	codePayloadTooLarge      errorCode = "PAYLOAD_TOO_LARGE"
+	codeUnsupportedMediaType errorCode = "UNSUPPORTED_MEDIA_TYPE"
+	codeRateLimited          errorCode = "RATE_LIMITED"
+	codeUnavailable          errorCode = "UNAVAILABLE"
+	codeInternal             errorCode = "INTERNAL_ERROR"
+)
+
+// Specific codes for errors clients are expected to handle
+const (
+	codeInvalidBody          errorCode = "INVALID_BODY"
+	codeValidationFailed     errorCode = "VALIDATION_FAILED"
+	codeMissingToken         errorCode = "MISSING_TOKEN"
+	codeInvalidToken         errorCode = "INVALID_TOKEN"
+	codeAdminRequired        errorCode = "ADMIN_REQUIRED"
+	codeSongNotFound         errorCode = "SONG_NOT_FOUND"
+	codeSectionNotFound      errorCode = "SECTION_NOT_FOUND"
+	codeDuplicateSong        errorCode = "DUPLICATE_SONG"
+	codeInvalidSongID        errorCode = "INVALID_SONG_ID"
+	codeInvalidDuration      errorCode = "INVALID_DURATION"
+	codeInvalidSectionID     errorCode = "INVALID_SECTION_ID"
+	codeInvalidSection       errorCode = "INVALID_SECTION"
+	codeSectionOverlap       errorCode = "SECTION_OVERLAP"
+	codeTooManySections      errorCode = "TOO_MANY_SECTIONS"
+	codeSongQuotaExceeded    errorCode = "SONG_QUOTA_EXCEEDED"
+	codeSectionQuotaExceeded errorCode = "SECTION_QUOTA_EXCEEDED"
+	codeInvalidPagination    errorCode = "INVALID_PAGINATION"
+	codeInvalidCursor        errorCode = "INVALID_CURSOR"
+	codeRequestTimeout       errorCode = "REQUEST_TIMEOUT"
+	codeSongModified         errorCode = "SONG_MODIFIED"
+	codeIdempotencyKeyReused errorCode = "IDEMPOTENCY_KEY_REUSED"
+	codeReadOnly             errorCode = "READ_ONLY"
+)
+
+// Sends a successful response; data is left out when nil
+func respond(c *gin.Context, status int, message string, data any) {
+	c.JSON(status, envelope{Message: message, Data: data})
+}
+
+// Sends an error response with the generic code for its status
+func respondError(c *gin.Context, status int, message string) {
+	respondErrorCode(c, status, statusErrorCode(status), message)
+}
+
+// Sends an error response with a specific code
+func respondErrorCode(c *gin.Context, status int, code errorCode, message string) {
+	// A server error caused by the request running out of time is reported as the timeout
+	if status >= http.StatusInternalServerError && errors.Is(c.Request.Context().Err(), context.DeadlineExceeded) {
+		respondTimeout(c)
+		return
+	}
+	c.JSON(status, errorResponse{Error: apiError{Code: code, Message: message}})
+}
+
+// Sends the 503 for a request that ran past REQUEST_TIMEOUT
+func respondTimeout(c *gin.Context) {
+	c.JSON(http.StatusServiceUnavailable, errorResponse{Error: apiError{
+		Code:    codeRequestTimeout,
+		Message: "Request timed out, try again later"}})
+}
+
+// Sends a 400 listing every field of the request body that failed validation
+func respondValidationError(c *gin.Context, fields []fieldError) {
+	c.JSON(http.StatusBadRequest, errorResponse{Error: apiError{
+		Code:    codeValidationFailed,
+		Message: "Invalid request: " + fieldErrorsMessage(fields),
+		Fields:  fields}})
+}
+
+// Like respondError, but also stops the remaining handlers; for middleware
+func abortWithError(c *gin.Context, status int, message string) {
+	abortWithErrorCode(c, status, statusErrorCode(status), message)
+}
+
+// Like respondErrorCode, but also stops the remaining handlers; for middleware
+func abortWithErrorCode(c *gin.Context, status int, code errorCode, message string) {
+	c.Abort()
+	respondErrorCode(c, status, code, message)
+}
+
+// Generic code for each error status the API returns
+func statusErrorCode(status int) errorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return codeBadRequest
+	case http.StatusUnauthorized:
+		return codeUnauthorized
+	case http.StatusForbidden:
+		return codeForbidden
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusMethodNotAllowed:
+		return codeMethodNotAllowed
+	case http.StatusNotAcceptable:
+		return codeNotAcceptable
+	case http.StatusConflict:
+		return codeConflict
+	case http.StatusPreconditionFailed:
+		return codePreconditionFailed
+	case http.StatusRequestEntityTooLarge:
+		return codePayloadTooLarge
+	case http.StatusUnsupportedMediaType:
+		return codeUnsupportedMediaType
+	case http.StatusTooManyRequests:
+		return codeRateLimited
+	case http.StatusServiceUnavailable:
+		return codeUnavailable
+	default:
+		return codeInternal
+	}
+}
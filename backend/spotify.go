@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const spotifyTracksURL = "https://api.spotify.com/v1/tracks/"
+
+// How long addSong waits for Spotify before storing a song without its metadata
+const spotifyLookupTimeout = 3 * time.Second
+
+// The parts of a Spotify track object the API stores
+type spotifyTrack struct {
+	Name       string `json:"name"`
+	DurationMs int    `json:"duration_ms"`
+	Artists    []struct {
+		Name string `json:"name"`
+	} `json:"artists"`
+}
+
+// Fetches a track's metadata from the Spotify Web API using the user's access token
+func fetchSpotifyTrack(ctx context.Context, token, trackID string) (spotifyTrack, error) {
+	var track spotifyTrack
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, spotifyTracksURL+url.PathEscape(trackID), nil)
+	if err != nil {
+		return track, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return track, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return track, errors.New("spotify returned " + resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&track)
+	return track, err
+}
+
+// Fills in the title, artist and duration missing from song with the track's metadata
+// from Spotify. When Spotify can't be reached or doesn't know the track, the song is
+// left as it is, so it is still stored by its ID.
+func enrichSong(c *gin.Context, song *songRequest) {
+	if song.Title != "" && song.Artist != "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), spotifyLookupTimeout)
+	defer cancel()
+
+	track, err := fetchSpotifyTrack(ctx, spotifyAccessToken(c), song.SongID)
+	if err != nil {
+		slog.Warn("spotify track lookup failed",
+			slog.String("request_id", requestID(c)),
+			slog.String("song_id", song.SongID),
+			slog.String("error", err.Error()))
+		return
+	}
+
+	if song.Title == "" {
+		song.Title = track.Name
+	}
+	if song.Artist == "" {
+		artists := make([]string, len(track.Artists))
+		for i, artist := range track.Artists {
+			artists[i] = artist.Name
+		}
+		song.Artist = strings.Join(artists, ", ")
+	}
+	if song.Duration == nil && track.DurationMs > 0 {
+		song.Duration = &track.DurationMs
+	}
+}
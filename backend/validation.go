@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Makes validation errors name fields by their JSON names, as clients send them
+func setupValidator() {
+	validate, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+}
+
+// Runs the binding tags of a decoded request body, returning one fieldError per
+// failed rule, or nil when the body is valid
+func validateRequest(obj any) []fieldError {
+	err := binding.Validator.ValidateStruct(obj)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return []fieldError{{Message: err.Error()}}
+	}
+
+	fields := make([]fieldError, len(validationErrors))
+	for i, fe := range validationErrors {
+		fields[i] = newFieldError(fe)
+	}
+	return fields
+}
+
+func newFieldError(fe validator.FieldError) fieldError {
+	// The namespace starts with the Go name of the request struct, which means nothing to clients
+	_, field, _ := strings.Cut(fe.Namespace(), ".")
+	if field == "" {
+		field = fe.Field()
+	}
+
+	var message string
+	switch fe.Tag() {
+	case "required":
+		message = fmt.Sprintf("%s is required", field)
+	case "len":
+		message = fmt.Sprintf("%s must be exactly %s characters", field, fe.Param())
+	case "min":
+		message = fmt.Sprintf("%s must be at least %s characters", field, fe.Param())
+	case "max":
+		message = fmt.Sprintf("%s must be at most %s characters", field, fe.Param())
+	case "gte":
+		message = fmt.Sprintf("%s must be at least %s", field, fe.Param())
+	case "lte":
+		message = fmt.Sprintf("%s must be at most %s", field, fe.Param())
+	default:
+		message = fmt.Sprintf("%s failed the %s rule", field, fe.Tag())
+	}
+
+	return fieldError{Field: field, Rule: fe.Tag(), Message: message}
+}
+
+// Joins field errors into one line, for places that report a single message per item
+func fieldErrorsMessage(fields []fieldError) string {
+	messages := make([]string, len(fields))
+	for i, field := range fields {
+		messages[i] = field.Message
+	}
+	return strings.Join(messages, "; ")
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Build information, injected at build time with
+// -ldflags "-X main.version=... -X main.commit=... -X main.buildTime=..."
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
+
+// Reports which build of the server is running
+//
+//	@Summary	Build information of the running server
+//	@Tags		system
+//	@Produce	json
+//	@Success	200	{object}	envelope{data=versionResponse}
+//	@Router		/version [get]
+func versionInfo(c *gin.Context) {
+	respond(c, http.StatusOK, "", versionResponse{
+		Version:   version,
+		Commit:    commit,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+	})
+}